@@ -10,6 +10,7 @@ import logger from "@fulltemplate/logger";
 import { env } from "~/env";
 import { io, setupSocketIO } from "~/lib/socket";
 import { initPorts } from "./lib/init";
+import { subscribeConnectionEvents } from "./lib/kafka";
 import router from "./server/routes";
 
 const app = express();
@@ -41,6 +42,12 @@ void (async () => {
     logger.error("Kafka producer connection Error", err);
   }
 
+  try {
+    await subscribeConnectionEvents();
+  } catch (err) {
+    logger.error("Kafka connection events consumer Error", err);
+  }
+
   try {
     await initPorts();
   } catch (err) {
@@ -1,3 +1,9 @@
+import { kafka } from "@fulltemplate/kafka";
+import logger from "@fulltemplate/logger";
+
+import type { ConnectionEvent } from "~/server/services/connection.service";
+import { recordConnectionEvent } from "~/server/services/connection.service";
+
 // import {
 // 	sendInviteNode,
 // 	sendVerifyNode,
@@ -41,3 +47,27 @@ export const subscribeKafkaPolls = () => {
     });
   });
 };
+
+// Consumes session events (usage, quota_exceeded, expired) published by slf-server.
+export const subscribeConnectionEvents = async () => {
+  const consumer = kafka.consumer({ groupId: "connection-events-group" });
+  await consumer.connect();
+  await consumer.subscribe({ topic: "connection.events" });
+
+  await consumer.run({
+    eachMessage: async ({ message }) => {
+      if (!message.value) {
+        return;
+      }
+      try {
+        await recordConnectionEvent(
+          JSON.parse(message.value.toString()) as ConnectionEvent,
+        );
+      } catch (error) {
+        logger.error("Connection event handling failed", error);
+      }
+    },
+  });
+
+  return consumer;
+};
@@ -13,12 +13,17 @@ export const createConnectionHandler = async (req: Request, res: Response) => {
   }
   const result = await connectionService.createConnection(
     res.locals.apiKey.id as string,
+    req.body,
   );
 
   if (!result.success) {
     switch (result.error) {
       case "no_ports_available":
         return res.status(503).json(result);
+      case "quota_exceeded":
+        return res.status(429).json(result);
+      case "connection_not_found":
+        return res.status(404).json(result);
       case "validation_error":
         return res.status(400).json(result);
       default:
@@ -29,6 +34,39 @@ export const createConnectionHandler = async (req: Request, res: Response) => {
   return res.status(201).json(result);
 };
 
+export const getConnectionHandler = async (req: Request, res: Response) => {
+  if (!res.locals.apiKey) {
+    return res.status(401).json({
+      success: false,
+      message: "Unauthorized",
+      error: "unauthorized",
+    });
+  }
+  if (!req.params.id) {
+    return res.status(400).json({
+      success: false,
+      message: "Bad request",
+      error: "missing_id",
+    });
+  }
+
+  const result = await connectionService.getConnection(
+    res.locals.apiKey.id as string,
+    req.params.id,
+  );
+
+  if (!result.success) {
+    switch (result.error) {
+      case "connection_not_found":
+        return res.status(404).json(result);
+      default:
+        return res.status(500).json(result);
+    }
+  }
+
+  return res.status(200).json(result);
+};
+
 export const stopConnectionHandler = async (req: Request, res: Response) => {
   if (!res.locals.apiKey) {
     return res.status(401).json({
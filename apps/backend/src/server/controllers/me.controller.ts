@@ -0,0 +1,22 @@
+/* eslint-disable @typescript-eslint/no-unsafe-member-access */
+import type { Request, Response } from "express";
+
+export const getMeHandler = (_req: Request, res: Response) => {
+  if (!res.locals.apiKey) {
+    return res.status(401).json({
+      success: false,
+      message: "Unauthorized",
+      error: "unauthorized",
+    });
+  }
+
+  return res.status(200).json({
+    success: true,
+    message: "API key is valid",
+    data: {
+      apiKeyId: res.locals.apiKey.id as string,
+      expiresAt: res.locals.apiKey.expiresAt as Date,
+      email: (res.locals.apiKey.user?.email ?? null) as string | null,
+    },
+  });
+};
@@ -6,6 +6,7 @@ import * as connectionController from "~/server/controllers/connection.controlle
 const router = Router();
 
 router.post("/", connectionController.createConnectionHandler);
+router.get("/:id", connectionController.getConnectionHandler);
 router.delete("/:id", connectionController.stopConnectionHandler);
 router.patch("/:id", connectionController.updateConnectionHandler);
 
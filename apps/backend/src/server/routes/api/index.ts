@@ -2,6 +2,7 @@ import { Router } from "express";
 
 import { authenticateApiKey } from "~/server/middlewares/auth";
 import connectionRoutes from "./connection";
+import meRoutes from "./me";
 
 const router = Router();
 
@@ -9,5 +10,6 @@ const router = Router();
 router.use(authenticateApiKey);
 
 router.use("/connection", connectionRoutes);
+router.use("/me", meRoutes);
 
 export default router;
@@ -0,0 +1,9 @@
+import { Router } from "express";
+
+import * as meController from "~/server/controllers/me.controller";
+
+const router = Router();
+
+router.get("/", meController.getMeHandler);
+
+export default router;
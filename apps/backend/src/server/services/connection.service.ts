@@ -1,3 +1,6 @@
+import { randomBytes } from "node:crypto";
+import { isIP } from "node:net";
+
 import { db } from "@fulltemplate/db";
 import { kafkaProducer } from "@fulltemplate/kafka";
 import logger from "@fulltemplate/logger";
@@ -6,18 +9,215 @@ import type { ServiceResponse } from "~/types";
 import { env } from "~/env";
 import { getRandomAvailablePorts, releasePorts } from "~/lib/util";
 
+// Session options the CLI may set, forwarded to slf-server in the start message.
+const CONNECTION_OPTION_KEYS = [
+  "mode",
+  "protocol",
+  "balance",
+  "access",
+  "headers",
+  "errorPages",
+  "allowCidrs",
+  "denyCidrs",
+  "rateLimit",
+  "bandwidth",
+  "timeouts",
+] as const;
+
+type ConnectionOptions = Partial<
+  Record<(typeof CONNECTION_OPTION_KEYS)[number], unknown>
+>;
+
+const pickConnectionOptions = (body: unknown): ConnectionOptions => {
+  const options: ConnectionOptions = {};
+  if (!body || typeof body !== "object") {
+    return options;
+  }
+  for (const key of CONNECTION_OPTION_KEYS) {
+    const value = (body as Record<string, unknown>)[key];
+    if (value !== undefined) {
+      options[key] = value;
+    }
+  }
+  return options;
+};
+
+// Matches edge.MaxErrorPageSize in slf-server.
+const MAX_ERROR_PAGE_SIZE = 64 * 1024;
+
+// A CIDR or a single address, as slf-server accepts them.
+const isCIDR = (value: unknown): boolean => {
+  if (typeof value !== "string") {
+    return false;
+  }
+  const [address, bits, ...rest] = value.trim().split("/");
+  const version = isIP(address ?? "");
+  if (version === 0 || rest.length > 0) {
+    return false;
+  }
+  if (bits === undefined) {
+    return true;
+  }
+  const max = version === 4 ? 32 : 128;
+  return /^\d+$/.test(bits) && Number(bits) <= max;
+};
+
+const validateCIDRs = (name: string, value: unknown): string | null => {
+  if (value === undefined) {
+    return null;
+  }
+  if (!Array.isArray(value)) {
+    return `${name} must be a list of CIDRs`;
+  }
+  const invalid = value.find((cidr) => !isCIDR(cidr));
+  return invalid === undefined
+    ? null
+    : `${name} contains an invalid CIDR: ${String(invalid)}`;
+};
+
+// Rejects options slf-server would refuse or drop, so the CLI hears about
+// them instead of getting a session that silently ignores them.
+const validateConnectionOptions = (
+  options: ConnectionOptions,
+): string | null => {
+  // slf-server refuses the whole session when a CIDR does not parse
+  const cidrError =
+    validateCIDRs("allowCidrs", options.allowCidrs) ??
+    validateCIDRs("denyCidrs", options.denyCidrs) ??
+    validateCIDRs(
+      "access.oauthProxies",
+      (options.access as Record<string, unknown> | undefined)?.oauthProxies,
+    );
+  if (cidrError) {
+    return cidrError;
+  }
+  if (options.errorPages !== undefined) {
+    const pages = options.errorPages as Record<string, unknown> | null;
+    if (!pages || typeof pages !== "object") {
+      return "errorPages must be an object";
+    }
+    for (const key of ["html", "json"]) {
+      const page = pages[key];
+      if (page === undefined) {
+        continue;
+      }
+      if (typeof page !== "string") {
+        return `errorPages.${key} must be a string`;
+      }
+      if (Buffer.byteLength(page) > MAX_ERROR_PAGE_SIZE) {
+        return `errorPages.${key} is larger than 64 KiB`;
+      }
+    }
+  }
+  return null;
+};
+
+// Connection statuses that still hold a session on slf-server.
+const ACTIVE_STATUSES = ["connecting", "connected", "reconnecting"];
+
+// Remaining monthly transfer allowance for an API key, null for unlimited.
+const getRemainingQuota = async (apiKeyId: string): Promise<bigint | null> => {
+  const apiKey = await db.apiKey.findUnique({
+    where: { id: apiKeyId },
+    select: { monthlyQuotaBytes: true },
+  });
+  if (apiKey?.monthlyQuotaBytes == null) {
+    return null;
+  }
+
+  const now = new Date();
+  const monthStart = new Date(now.getFullYear(), now.getMonth(), 1);
+  const usage = await db.connection.aggregate({
+    where: { apiKeyId, createdAt: { gte: monthStart } },
+    _sum: { bytesUp: true, bytesDown: true },
+  });
+  const used = (usage._sum.bytesUp ?? 0n) + (usage._sum.bytesDown ?? 0n);
+
+  return apiKey.monthlyQuotaBytes - used;
+};
+
 interface CreateConnectionResult {
   id: string;
   address: string;
   externalPort: number;
   internalPort: number;
   status: string;
+  shareToken?: string;
+  agentSecret?: string;
 }
 
+// Another agent for an existing session: it dials the same internal port
+// and the server spreads external streams across all agents.
+const joinConnection = async (
+  apiKeyId: string,
+  connectionId: string,
+): Promise<ServiceResponse<CreateConnectionResult>> => {
+  const connection = await db.connection.findFirst({
+    where: {
+      id: connectionId,
+      apiKeyId,
+      status: { in: ACTIVE_STATUSES },
+    },
+  });
+  if (!connection) {
+    return {
+      success: false,
+      message: "Connection not found",
+      error: "connection_not_found",
+    };
+  }
+
+  return {
+    success: true,
+    message: "Joined connection successfully",
+    data: {
+      id: connection.id,
+      address: connection.address,
+      externalPort: connection.externalPort,
+      internalPort: connection.internalPort,
+      status: connection.status,
+      shareToken: connection.shareToken ?? undefined,
+      agentSecret: connection.agentSecret ?? undefined,
+    },
+  };
+};
+
 export const createConnection = async (
   apiKeyId: string,
+  body?: unknown,
 ): Promise<ServiceResponse<CreateConnectionResult>> => {
   try {
+    const remainingQuota = await getRemainingQuota(apiKeyId);
+    if (remainingQuota !== null && remainingQuota <= 0n) {
+      return {
+        success: false,
+        message: "Monthly transfer quota exceeded",
+        error: "quota_exceeded",
+      };
+    }
+
+    const join = (body as { join?: unknown } | undefined)?.join;
+    if (typeof join === "string") {
+      return joinConnection(apiKeyId, join);
+    }
+
+    const options = pickConnectionOptions(body);
+    const invalid = validateConnectionOptions(options);
+    if (invalid) {
+      return {
+        success: false,
+        message: invalid,
+        error: "validation_error",
+      };
+    }
+    // Private sessions are only reachable by peers holding this token.
+    const shareToken =
+      options.mode === "private"
+        ? randomBytes(24).toString("base64url")
+        : undefined;
+    // CLIs prove they were issued the session with this before serving it.
+    const agentSecret = randomBytes(24).toString("base64url");
+
     const ports = await getRandomAvailablePorts(2);
     if (ports.length !== 2) {
       return {
@@ -37,6 +237,8 @@ export const createConnection = async (
           },
         },
         status: "connecting",
+        shareToken,
+        agentSecret,
       },
     });
 
@@ -46,10 +248,17 @@ export const createConnection = async (
         {
           key: connection.id,
           value: JSON.stringify({
+            ...options,
+            shareToken,
+            // Forward sessions of the same API key may reach this one.
+            owner: apiKeyId,
+            agentSecret,
             type: "start",
             externalPort: connection.externalPort,
             internalPort: connection.internalPort,
             sessionId: connection.id,
+            quotaBytes:
+              remainingQuota === null ? undefined : Number(remainingQuota),
           }),
         },
       ],
@@ -64,6 +273,8 @@ export const createConnection = async (
         externalPort: connection.externalPort,
         internalPort: connection.internalPort,
         status: connection.status,
+        shareToken: connection.shareToken ?? undefined,
+        agentSecret: connection.agentSecret ?? undefined,
       },
     };
   } catch (error) {
@@ -76,13 +287,20 @@ export const createConnection = async (
   }
 };
 
-export const stopConnection = async (
+interface ConnectionStatusResult {
+  id: string;
+  status: string;
+}
+
+// Lets a CLI check whether its session is still active before it
+// re-attaches.
+export const getConnection = async (
+  apiKeyId: string,
   connectionId: string,
-): Promise<ServiceResponse<boolean>> => {
-  const connection = await db.connection.findUnique({
-    where: {
-      id: connectionId,
-    },
+): Promise<ServiceResponse<ConnectionStatusResult>> => {
+  const connection = await db.connection.findFirst({
+    where: { id: connectionId, apiKeyId },
+    select: { id: true, status: true },
   });
   if (!connection) {
     return {
@@ -91,20 +309,27 @@ export const stopConnection = async (
       error: "connection_not_found",
     };
   }
-  if (connection.status !== "connecting" && connection.status !== "connected") {
-    return {
-      success: true,
-      message: "Connection is not active",
-      data: true,
-    };
-  }
+
+  return {
+    success: true,
+    message: "Connection found",
+    data: connection,
+  };
+};
+
+// Marks an active session ended, tells slf-server to stop it and frees
+// its ports.
+const endSession = async (
+  connection: {
+    id: string;
+    externalPort: number;
+    internalPort: number;
+  },
+  status: string,
+) => {
   await db.connection.update({
-    where: {
-      id: connectionId,
-    },
-    data: {
-      status: "stopped",
-    },
+    where: { id: connection.id },
+    data: { status },
   });
   await kafkaProducer.send({
     topic: "connection",
@@ -122,6 +347,50 @@ export const stopConnection = async (
   });
 
   await releasePorts([connection.externalPort, connection.internalPort]);
+};
+
+// Each session gets the quota left when it starts, so sessions running in
+// parallel could together use it several times over. Usage reports re-check
+// the key's total and stop every session once it is used up.
+const enforceQuota = async (apiKeyId: string) => {
+  const remainingQuota = await getRemainingQuota(apiKeyId);
+  if (remainingQuota === null || remainingQuota > 0n) {
+    return;
+  }
+
+  const active = await db.connection.findMany({
+    where: { apiKeyId, status: { in: ACTIVE_STATUSES } },
+    select: { id: true, externalPort: true, internalPort: true },
+  });
+  for (const connection of active) {
+    logger.info(`Stopping connection ${connection.id}, monthly quota used up`);
+    await endSession(connection, "quota_exceeded");
+  }
+};
+
+export const stopConnection = async (
+  connectionId: string,
+): Promise<ServiceResponse<boolean>> => {
+  const connection = await db.connection.findUnique({
+    where: {
+      id: connectionId,
+    },
+  });
+  if (!connection) {
+    return {
+      success: false,
+      message: "Connection not found",
+      error: "connection_not_found",
+    };
+  }
+  if (!ACTIVE_STATUSES.includes(connection.status)) {
+    return {
+      success: true,
+      message: "Connection is not active",
+      data: true,
+    };
+  }
+  await endSession(connection, "stopped");
 
   return {
     success: true,
@@ -146,6 +415,14 @@ export const updateConnectionStatus = async (
       error: "connection_not_found",
     };
   }
+  // a late report from the CLI must not revive a stopped connection
+  if (!ACTIVE_STATUSES.includes(connection.status)) {
+    return {
+      success: true,
+      message: "Connection is not active",
+      data: false,
+    };
+  }
   await db.connection.update({
     where: {
       id: connectionId,
@@ -161,3 +438,40 @@ export const updateConnectionStatus = async (
     data: true,
   };
 };
+
+export interface ConnectionEvent {
+  type: "usage" | "quota_exceeded" | "expired";
+  sessionId: string;
+  bytesUp: number;
+  bytesDown: number;
+}
+
+// Applies a session event published by slf-server.
+export const recordConnectionEvent = async (event: ConnectionEvent) => {
+  const connection = await db.connection.findUnique({
+    where: { id: event.sessionId },
+  });
+  if (!connection) {
+    logger.warn(`Event for unknown connection ${event.sessionId}`);
+    return;
+  }
+
+  await db.connection.update({
+    where: { id: connection.id },
+    data: {
+      bytesUp: BigInt(event.bytesUp),
+      bytesDown: BigInt(event.bytesDown),
+      lastSeenAt: new Date(),
+      ...(event.type !== "usage" && { status: event.type }),
+    },
+  });
+
+  // quota_exceeded and expired mean slf-server stopped the session
+  if (event.type !== "usage" && ACTIVE_STATUSES.includes(connection.status)) {
+    await releasePorts([connection.externalPort, connection.internalPort]);
+  }
+
+  if (event.type === "usage") {
+    await enforceQuota(connection.apiKeyId);
+  }
+};
@@ -1,62 +1,74 @@
 package cmd
 
 import (
+	"cli/internal/config"
+	"cli/internal/output"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v2"
 )
 
 var setToken string
 var setServerUrl string
 
-type Config struct {
-	Token     string `yaml:"token"`
-	ServerURL string `yaml:"serverUrl"`
-}
-
 var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "Define configs for selfgrok",
-	Run: func(cmd *cobra.Command, args []string) {
-		configPath := getConfigPath()
-		cfg := Config{}
+	Example: `selfgrok config --setToken <your_token> --setServerUrl http://localhost:3000
+selfgrok config --profile staging --setServerUrl https://staging.example.com
+selfgrok config --profile staging`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Read()
+		if err != nil {
+			return fmt.Errorf("cannot read config file: %w", err)
+		}
+		path, _ := config.Path() // Read succeeded, so did Path
 
-		_ = os.MkdirAll(filepath.Dir(configPath), os.ModePerm)
-		if data, err := os.ReadFile(configPath); err == nil {
-			_ = yaml.Unmarshal(data, &cfg)
+		name := config.ProfileName()
+		profile := config.Profile{Token: cfg.Token, ServerURL: cfg.ServerURL}
+		if name != "" {
+			profile = cfg.Profiles[name]
 		}
 
 		if setToken == "" && setServerUrl == "" {
-			printConfig(cfg)
-			return
+			if profile.Token == "" {
+				profile.Token, _ = config.Token(name)
+			}
+			printConfig(path, name, profile)
+			return nil
 		}
 
 		if setToken != "" {
-			cfg.Token = setToken
+			store, err := config.SetToken(name, setToken)
+			if err != nil {
+				return fmt.Errorf("cannot store token: %w", err)
+			}
+			output.Printf("Token stored in the %s.\n", store)
+			// never keep it in plaintext next to the server URL
+			profile.Token = ""
 		}
 		if setServerUrl != "" {
-			cfg.ServerURL = setServerUrl
+			profile.ServerURL = setServerUrl
 		}
 
-		file, err := os.Create(configPath)
-		if err != nil {
-			fmt.Println("Cannot create config file:", err)
-			return
+		if name == "" {
+			cfg.Token = profile.Token
+			cfg.ServerURL = profile.ServerURL
+		} else {
+			if cfg.Profiles == nil {
+				cfg.Profiles = make(map[string]config.Profile)
+			}
+			cfg.Profiles[name] = profile
 		}
-		defer file.Close()
 
-		encoder := yaml.NewEncoder(file)
-		defer encoder.Close()
-		if err := encoder.Encode(cfg); err != nil {
-			fmt.Println("Config writing error:", err)
-			return
+		if err := config.Save(cfg); err != nil {
+			return fmt.Errorf("config writing error: %w", err)
 		}
 
-		fmt.Println("Config saved successfully.")
+		output.Result(map[string]any{"type": "config_saved", "path": path})
+		output.Println("Config saved successfully.")
+		return nil
 	},
 }
 
@@ -66,16 +78,22 @@ func init() {
 	rootCmd.AddCommand(configCmd)
 }
 
-func getConfigPath() string {
-	homeDir, _ := os.UserHomeDir()
-	return filepath.Join(homeDir, ".selfgrok", "config.yaml")
-}
-
-func printConfig(cfg Config) {
-	fmt.Println("Current configuration:")
+func printConfig(path, name string, profile config.Profile) {
+	if name == "" {
+		name = "default"
+	}
+	token := profile.Token
+	if token != "" {
+		token = config.MaskToken(token)
+	}
+	output.Result(map[string]any{"type": "config", "path": path, "profile": name, "token": token, "serverUrl": profile.ServerURL})
+	if output.IsJSON() {
+		return
+	}
+	fmt.Printf("Current configuration (%s, profile %s):\n", path, name)
 	pairs := map[string]string{
-		"Token":     cfg.Token,
-		"ServerURL": cfg.ServerURL,
+		"Token":     token,
+		"ServerURL": profile.ServerURL,
 	}
 
 	maxKeyLen := 0
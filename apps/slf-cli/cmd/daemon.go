@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"cli/internal/api"
+	"cli/internal/config"
+	"cli/internal/daemon"
+	"cli/internal/output"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var daemonAll bool
+var daemonDetach bool
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon [name...]",
+	Short: "run tunnels in the background",
+	Long:  "runs tunnels from the config file in a background daemon managed with ls, stop and logs; names are handed to the daemon when one is already running",
+	Example: `selfgrok daemon --detach web api
+selfgrok daemon --all`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names := args
+		if daemonAll {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+			names = nil
+			for name := range cfg.Tunnels {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+
+		client := daemon.NewClient()
+		if client.Running() {
+			failed := startTunnels(names, client.Start)
+			if len(names) == 0 {
+				output.Println("Daemon is already running.")
+			}
+			return failed
+		}
+
+		if daemonDetach {
+			dir, err := config.Dir()
+			if err != nil {
+				return err
+			}
+			logPath := filepath.Join(dir, "daemon.log")
+			detachArgs := append(append([]string{"daemon"}, config.Args()...), names...)
+			pid, err := daemon.Detach(detachArgs, logPath)
+			if err != nil {
+				return fmt.Errorf("cannot start daemon: %w", err)
+			}
+			for i := 0; i < 50 && !client.Running(); i++ {
+				time.Sleep(100 * time.Millisecond)
+			}
+			output.Result(map[string]any{"type": "daemon_started", "pid": pid, "log": logPath})
+			output.Printf("Daemon started (pid %d), logs in %s\n", pid, logPath)
+			return nil
+		}
+
+		apiClient, err := api.New()
+		if err != nil {
+			return fmt.Errorf("API client init failed: %w", err)
+		}
+
+		srv := daemon.NewServer(apiClient)
+		// failures are reported; the daemon still serves the other tunnels
+		_ = startTunnels(names, srv.Start)
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-stop
+			output.Println("\nShutting down daemon...")
+			srv.Shutdown()
+		}()
+
+		if err := srv.Serve(); err != nil {
+			srv.Shutdown()
+			return fmt.Errorf("daemon stopped: %w", err)
+		}
+		return nil
+	},
+}
+
+// startTunnels starts each named tunnel with start, reporting every
+// outcome, and returns an error when any of them failed.
+func startTunnels(names []string, start func(name string) (daemon.TunnelInfo, error)) error {
+	var failed []string
+	for _, name := range names {
+		info, err := start(name)
+		if err != nil {
+			output.Emit(output.Event{Type: output.EventError, Error: fmt.Sprintf("tunnel %q: %v", name, err)})
+			output.Printf("Tunnel %q: %v\n", name, err)
+			failed = append(failed, name)
+			continue
+		}
+		output.Result(map[string]any{"type": "tunnel_started", "tunnel": info})
+		output.Printf("Started %s (%s) on %s:%d\n", info.Name, info.ID, info.Address, info.Port)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d tunnels failed to start: %s", len(failed), len(names), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func init() {
+	daemonCmd.Flags().BoolVar(&daemonAll, "all", false, "Start every tunnel in the config file")
+	daemonCmd.Flags().BoolVar(&daemonDetach, "detach", false, "Run in the background, detached from the terminal")
+	rootCmd.AddCommand(daemonCmd)
+}
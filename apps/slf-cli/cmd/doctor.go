@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"cli/internal/doctor"
+	"cli/internal/output"
+	"cli/internal/session"
+	"errors"
+
+	"github.com/spf13/cobra"
+)
+
+var doctorHost string
+var doctorPort string
+var doctorTarget string
+var doctorTLSSkipVerify bool
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check config, server and local target connectivity",
+	Long:  "checks the config, API reachability and auth, opens a test session to measure the tunnel's RTT and throughput, and checks the local target",
+	Example: `selfgrok doctor
+selfgrok doctor --port 3000
+selfgrok --profile staging doctor --target unix:///var/run/docker.sock`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var opts doctor.Options
+		if doctorPort != "" || doctorTarget != "" {
+			opts.Target = &session.Options{
+				Host:          doctorHost,
+				Port:          doctorPort,
+				Target:        doctorTarget,
+				TLSSkipVerify: doctorTLSSkipVerify,
+			}
+		}
+
+		results := doctor.Report(opts)
+
+		failed := false
+		for _, r := range results {
+			if r.Status == doctor.StatusFail {
+				failed = true
+			}
+		}
+
+		output.Result(map[string]any{"type": "doctor", "checks": results})
+		output.Println()
+		for _, r := range results {
+			output.Printf("  %-14s %-5s %s\n", r.Name, r.Status, r.Detail)
+		}
+		output.Println()
+		if failed {
+			return errors.New("some checks failed")
+		}
+		output.Println("All checks passed.")
+		return nil
+	},
+}
+
+func init() {
+	doctorCmd.Flags().StringVar(&doctorHost, "host", "127.0.0.1", "Local target host")
+	doctorCmd.Flags().StringVar(&doctorPort, "port", "", "Local target port to check")
+	doctorCmd.Flags().StringVar(&doctorTarget, "target", "", "Local target URL to check (tcp://, unix://, tls://)")
+	doctorCmd.Flags().BoolVar(&doctorTLSSkipVerify, "tls-skip-verify", false, "Skip certificate checks for tls:// targets")
+	rootCmd.AddCommand(doctorCmd)
+}
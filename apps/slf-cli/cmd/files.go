@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"cli/internal/api"
+	"cli/internal/files"
+	"cli/internal/session"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var FilesBasicAuth string
+var FilesHidden bool
+
+var filesCmd = &cobra.Command{
+	Use:   "files <dir>",
+	Short: "share a directory",
+	Long:  "serves a directory over HTTP from inside the CLI (listing, range requests, optional basic auth) and exposes it through a session",
+	Example: `selfgrok files ./dist
+selfgrok files ./build --basic-auth dev:secret`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var user, pass string
+		if FilesBasicAuth != "" {
+			var ok bool
+			user, pass, ok = strings.Cut(FilesBasicAuth, ":")
+			if !ok || user == "" {
+				return usageError(cmd, "invalid --basic-auth, expected user:password")
+			}
+		}
+
+		// shared with the session, which moves it onto the dashboard
+		logger := log.New(os.Stderr, "", log.LstdFlags)
+		srv, err := files.NewServer(files.Options{Dir: args[0], User: user, Password: pass, Hidden: FilesHidden, Log: logger})
+		if err != nil {
+			return fmt.Errorf("cannot serve directory: %w", err)
+		}
+		defer srv.Close()
+
+		return session.Start(session.Options{
+			Dial:       srv.Dial,
+			Log:        logger,
+			Dashboard:  useDashboard(),
+			Connection: api.ConnectionOptions{Protocol: "tcp"},
+		})
+	},
+}
+
+func init() {
+	filesCmd.Flags().StringVar(&FilesBasicAuth, "basic-auth", "", "Require HTTP basic auth (user:password)")
+	filesCmd.Flags().BoolVar(&FilesHidden, "hidden", false, "Also serve files and directories starting with a dot")
+	rootCmd.AddCommand(filesCmd)
+}
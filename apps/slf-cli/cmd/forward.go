@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"cli/internal/connector"
+	"cli/internal/session"
+	"net"
+
+	"github.com/spf13/cobra"
+)
+
+var ForwardRemote string
+var ForwardLocal string
+var ShareToken string
+var forwardMaxReconnects int
+
+var forwardCmd = &cobra.Command{
+	Use:   "forward",
+	Short: "forward a local port to a remote target",
+	Long:  "listens locally and carries connections to another session's service, a port on its host or a host reachable from the server, like ssh -L",
+	Example: `selfgrok forward --remote <session>:5432 --local 127.0.0.1:5432
+selfgrok forward --remote <private-session> --share-token <token> --local 127.0.0.1:8080
+selfgrok forward --remote db.internal:5432`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ForwardLocal == "" {
+			_, port, err := net.SplitHostPort(ForwardRemote)
+			if err != nil {
+				return usageError(cmd, "--local is required when --remote has no port")
+			}
+			ForwardLocal = net.JoinHostPort("127.0.0.1", port)
+		}
+
+		return session.Forward(connector.ForwardOptions{
+			Local:      ForwardLocal,
+			Remote:     ForwardRemote,
+			ShareToken: ShareToken,
+			Reconnect:  connector.ReconnectPolicy{MaxAttempts: forwardMaxReconnects},
+		})
+	},
+}
+
+func init() {
+	forwardCmd.Flags().StringVar(&ForwardRemote, "remote", "", "Remote target (<session>, <session>:<port> or <host>:<port>)")
+	forwardCmd.Flags().StringVar(&ForwardLocal, "local", "", "Local listen address (default: 127.0.0.1:<remote port>)")
+	forwardCmd.Flags().StringVar(&ShareToken, "share-token", "", "Share token of a private session")
+	forwardCmd.Flags().IntVar(&forwardMaxReconnects, "max-reconnects", 0, "Give up after this many failed reconnect attempts (0: never)")
+	_ = forwardCmd.MarkFlagRequired("remote")
+	rootCmd.AddCommand(forwardCmd)
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"cli/internal/inspect"
+	"cli/internal/output"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var inspectorAddr string
+var inspectorTLSSkipVerify bool
+
+var inspectorCmd = &cobra.Command{
+	Use:   "inspector",
+	Short: "browse and replay captured requests",
+	Long:  "serves a local web page listing the requests captured with --inspect, with a button to replay each one against its local target, optionally with edited headers and body",
+	Example: `selfgrok inspector
+selfgrok inspector --addr 127.0.0.1:4041`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ln, err := net.Listen("tcp", inspectorAddr)
+		if err != nil {
+			return fmt.Errorf("cannot listen on %s: %w", inspectorAddr, err)
+		}
+		url := "http://" + ln.Addr().String()
+		output.Result(map[string]any{"type": "inspector", "url": url})
+		output.Printf("Inspector running on %s\n", url)
+
+		srv := &http.Server{
+			Handler:           inspect.Handler(inspectorTLSSkipVerify),
+			ReadHeaderTimeout: 30 * time.Second,
+		}
+		return srv.Serve(ln)
+	},
+}
+
+func init() {
+	inspectorCmd.Flags().StringVar(&inspectorAddr, "addr", "127.0.0.1:4040", "Listen address")
+	inspectorCmd.Flags().BoolVar(&inspectorTLSSkipVerify, "tls-skip-verify", false, "Skip certificate checks for tls:// targets")
+	rootCmd.AddCommand(inspectorCmd)
+}
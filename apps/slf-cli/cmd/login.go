@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"bufio"
+	"cli/internal/api"
+	"cli/internal/config"
+	"cli/internal/output"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var loginToken string
+var loginServerURL string
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Check an API token and store it securely",
+	Long:  "checks the token against the server and stores it in the OS keyring, or in ~/.selfgrok/credentials when no keyring is available",
+	Example: `selfgrok login --server-url https://selfgrok.example.com
+selfgrok --profile staging login --server-url https://staging.example.com
+echo "$TOKEN" | selfgrok login`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Read()
+		if err != nil {
+			return fmt.Errorf("cannot read config file: %w", err)
+		}
+
+		name := config.ProfileName()
+		profile := config.Profile{ServerURL: cfg.ServerURL}
+		if name != "" {
+			profile = cfg.Profiles[name]
+		}
+		if loginServerURL != "" {
+			profile.ServerURL = loginServerURL
+		}
+		if profile.ServerURL == "" {
+			return usageError(cmd, "--server-url is required when the profile has no server URL")
+		}
+
+		token := loginToken
+		if token == "" {
+			token, err = readToken()
+			if err != nil {
+				return fmt.Errorf("cannot read token: %w", err)
+			}
+		}
+		if token == "" {
+			return output.WithCode(errors.New("no token given"), output.ExitAuth)
+		}
+
+		me, err := api.NewWith(profile.ServerURL, token).Me()
+		if err != nil {
+			var apiErr *api.Error
+			if errors.As(err, &apiErr) && apiErr.Unauthorized() {
+				return fmt.Errorf("token rejected by the server: %w", err)
+			}
+			return fmt.Errorf("cannot check token: %w", err)
+		}
+
+		store, err := config.SetToken(name, token)
+		if err != nil {
+			return fmt.Errorf("cannot store token: %w", err)
+		}
+
+		profile.Token = ""
+		if name == "" {
+			cfg.Token = ""
+			cfg.ServerURL = profile.ServerURL
+		} else {
+			if cfg.Profiles == nil {
+				cfg.Profiles = make(map[string]config.Profile)
+			}
+			cfg.Profiles[name] = profile
+		}
+		if err := config.Save(cfg); err != nil {
+			return fmt.Errorf("config writing error: %w", err)
+		}
+
+		who := me.APIKeyID
+		if me.Email != "" {
+			who = me.Email
+		}
+		output.Result(map[string]any{"type": "logged_in", "serverUrl": profile.ServerURL, "user": who, "store": store})
+		output.Printf("Logged in to %s as %s (token %s, stored in the %s).\n",
+			profile.ServerURL, who, config.MaskToken(token), store)
+		return nil
+	},
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the stored API token",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := config.ProfileName()
+		if err := config.DeleteToken(name); err != nil {
+			return fmt.Errorf("cannot remove token: %w", err)
+		}
+
+		// drop plaintext tokens left by older versions too
+		cfg, err := config.Read()
+		if err == nil {
+			if name == "" {
+				cfg.Token = ""
+			} else if p, ok := cfg.Profiles[name]; ok {
+				p.Token = ""
+				cfg.Profiles[name] = p
+			}
+			err = config.Save(cfg)
+		}
+		if err != nil {
+			return fmt.Errorf("config writing error: %w", err)
+		}
+		output.Result(map[string]any{"type": "logged_out"})
+		output.Println("Logged out.")
+		return nil
+	},
+}
+
+func init() {
+	loginCmd.Flags().StringVar(&loginToken, "token", "", "API token (prompted for when not given)")
+	loginCmd.Flags().StringVar(&loginServerURL, "server-url", "", "Server URL (default: the profile's)")
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+}
+
+// readToken prompts for the token without echoing it, or reads it from
+// stdin when that is not a terminal.
+func readToken() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Print("API token: ")
+		b, err := term.ReadPassword(fd)
+		fmt.Println()
+		return strings.TrimSpace(string(b)), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"cli/internal/daemon"
+	"cli/internal/output"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var logsFollow bool
+
+var logsCmd = &cobra.Command{
+	Use:     "logs <id|name>",
+	Short:   "show daemon tunnel logs",
+	Long:    "prints the latest log lines of a tunnel run by the background daemon",
+	Example: "selfgrok logs web -f",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := daemon.NewClient()
+		since := 0
+		for {
+			res, err := client.Logs(args[0], since)
+			if err != nil {
+				return err
+			}
+			for _, line := range res.Lines {
+				output.Result(map[string]any{"type": "log", "line": line})
+				output.Println(line)
+			}
+			since = res.Next
+
+			if !logsFollow {
+				return nil
+			}
+			time.Sleep(time.Second)
+		}
+	},
+}
+
+func init() {
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Keep printing new lines")
+	rootCmd.AddCommand(logsCmd)
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"cli/internal/daemon"
+	"cli/internal/output"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var lsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "list daemon tunnels",
+	Long:  "lists the tunnels run by the background daemon",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, err := daemon.NewClient().List()
+		if err != nil {
+			return err
+		}
+		output.Result(map[string]any{"type": "tunnels", "tunnels": list})
+		if len(list) == 0 {
+			output.Println("No tunnels.")
+			return nil
+		}
+
+		output.Printf("  %-36s  %-12s  %-8s  %-24s  %s\n", "ID", "NAME", "STATUS", "PUBLIC", "UPTIME")
+		for _, t := range list {
+			uptime := "-"
+			if t.Status == daemon.StatusRunning {
+				uptime = time.Since(t.StartedAt).Round(time.Second).String()
+			}
+			output.Printf("  %-36s  %-12s  %-8s  %-24s  %s\n", t.ID, t.Name, t.Status, fmt.Sprintf("%s:%d", t.Address, t.Port), uptime)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lsCmd)
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"cli/internal/inspect"
+	"cli/internal/output"
+	"cli/internal/tunnel"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var replayTarget string
+var replayHeaders []string
+var replayRemoveHeaders []string
+var replayBody string
+var replayBodyFile string
+var replayTLSSkipVerify bool
+
+var replayCmd = &cobra.Command{
+	Use:   "replay [request-id]",
+	Short: "Replay a captured request",
+	Long:  "re-sends a captured inbound HTTP request to the local target, lists captured requests when no id is given",
+	Example: `selfgrok replay
+selfgrok replay 3f2a9c1b04de --header "X-Debug: 1" --body-file payload.json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return listCaptures()
+		}
+
+		c, err := inspect.Load(args[0])
+		if err != nil {
+			return fmt.Errorf("cannot load request: %w", err)
+		}
+
+		headers, err := tunnel.ParseHeaders(replayHeaders)
+		if err != nil {
+			return usageError(cmd, "%v", err)
+		}
+		for k, v := range headers {
+			c.Header.Set(k, v)
+		}
+		for _, k := range replayRemoveHeaders {
+			c.Header.Del(k)
+		}
+
+		if replayBodyFile != "" {
+			data, err := os.ReadFile(replayBodyFile)
+			if err != nil {
+				return fmt.Errorf("cannot read body file: %w", err)
+			}
+			c.Body = data
+			c.Truncated = false
+		} else if cmd.Flags().Changed("body") {
+			c.Body = []byte(replayBody)
+			c.Truncated = false
+		}
+
+		res, err := inspect.Replay(c, replayTarget, replayTLSSkipVerify)
+		if errors.Is(err, inspect.ErrTruncated) {
+			return usageError(cmd, "request %s: %v with --body or --body-file", c.ID, err)
+		}
+		if err != nil {
+			return fmt.Errorf("replay failed: %w", err)
+		}
+		defer res.Body.Close()
+
+		n, _ := io.Copy(io.Discard, res.Body)
+		output.Result(map[string]any{"type": "replayed", "id": c.ID, "status": res.StatusCode, "bytes": n})
+		output.Printf("%s %s -> %s (%d bytes)\n", c.Method, c.URI, res.Status, n)
+		return nil
+	},
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&replayTarget, "target", "", "Override local target (host:port or target URL)")
+	replayCmd.Flags().BoolVar(&replayTLSSkipVerify, "tls-skip-verify", false, "Skip certificate checks for tls:// targets")
+	replayCmd.Flags().StringArrayVar(&replayHeaders, "header", nil, "Set request header (\"Name: value\")")
+	replayCmd.Flags().StringArrayVar(&replayRemoveHeaders, "remove-header", nil, "Remove request header")
+	replayCmd.Flags().StringVar(&replayBody, "body", "", "Replace request body")
+	replayCmd.Flags().StringVar(&replayBodyFile, "body-file", "", "Replace request body with file contents")
+	rootCmd.AddCommand(replayCmd)
+}
+
+func listCaptures() error {
+	captures, err := inspect.List()
+	if err != nil {
+		return fmt.Errorf("cannot list requests: %w", err)
+	}
+	if output.IsJSON() {
+		list := make([]map[string]any, 0, len(captures))
+		for _, c := range captures {
+			list = append(list, map[string]any{"id": c.ID, "time": c.Time, "method": c.Method, "uri": c.URI, "truncated": c.Truncated})
+		}
+		output.Result(map[string]any{"type": "captures", "captures": list})
+		return nil
+	}
+	if len(captures) == 0 {
+		output.Println("No captured requests.")
+		return nil
+	}
+
+	for _, c := range captures {
+		note := ""
+		if c.Truncated {
+			note = "  (body truncated)"
+		}
+		output.Printf("  %s  %s  %-6s %s%s\n", c.ID, c.Time.Format("15:04:05"), c.Method, c.URI, note)
+	}
+	return nil
+}
@@ -2,41 +2,95 @@ package cmd
 
 import (
 	"cli/internal/config"
+	"cli/internal/dashboard"
+	"cli/internal/output"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
 )
 
+// outputFormat is the global --output flag.
+var outputFormat string
+
+// noTUI is the global --no-tui flag.
+var noTUI bool
+
+// configPath, profileName and stateDir are the global --config, --profile
+// and --state-dir flags.
+var configPath, profileName, stateDir string
+
 var rootCmd = &cobra.Command{
 	Use:     "selfgrok",
 	Short:   "your selfhosted ngrok",
 	Long:    "selfgrok, selfhosted ngrok",
 	Example: "selfgrok --help",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("\n Use \"selfgrok --help\" to see available commands.")
+		output.Println("\n Use \"selfgrok --help\" to see available commands.")
 	},
 
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		printBanner()
-		if cmd.Name() == "help" || cmd.Name() == "config" {
-			return
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		config.SetPath(configPath)
+		config.SetProfile(profileName)
+		config.SetStateDir(stateDir)
+		if err := output.SetFormat(outputFormat); err != nil {
+			return err
+		}
+		if !output.IsJSON() {
+			printBanner()
+		}
+		switch cmd.Name() {
+		case "help", "config", "login", "logout", "doctor", "replay", "inspector", "ls", "stop", "logs":
+			return nil
 		}
 
-		err := config.Validate()
-		if err != nil {
-			fmt.Println("Token is not set. Please run: selfgrok config --setToken <your_token>")
-			os.Exit(1)
+		if err := config.Validate(); err != nil {
+			return output.WithCode(fmt.Errorf("%w, please run: selfgrok%s config --setToken <your_token>", err, profileFlag()), output.ExitAuth)
 		}
+		return nil
 	},
+
+	// errors are reported by Execute, in the selected output format
+	SilenceErrors: true,
+	SilenceUsage:  true,
 }
 
+// Execute runs the command line and exits with the code documented for
+// the error it failed with, if any.
 func Execute() {
-	cobra.CheckErr(rootCmd.Execute())
+	if err := rootCmd.Execute(); err != nil {
+		output.Fail(err)
+	}
+}
+
+// usageError reports a command line the command cannot run with.
+func usageError(cmd *cobra.Command, format string, a ...any) error {
+	return fmt.Errorf("%s, see: %s --help", fmt.Sprintf(format, a...), cmd.CommandPath())
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringP("config", "c", "", "config file path")
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return usageError(cmd, "%v", err)
+	})
+	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "config file path (default ~/.selfgrok/config.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&profileName, "profile", "p", "", "config profile to use (env SELFGROK_PROFILE)")
+	rootCmd.PersistentFlags().StringVar(&stateDir, "state-dir", "", "directory for credentials, captures and the daemon socket (env SELFGROK_STATE_DIR, default: the config file's directory)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", output.FormatText, "Output format (text, json)")
+	rootCmd.PersistentFlags().BoolVar(&noTUI, "no-tui", false, "Print log lines instead of the live dashboard")
+}
+
+// profileFlag returns the --profile flag for hints, empty for the
+// default profile.
+func profileFlag() string {
+	if name := config.ProfileName(); name != "" {
+		return " --profile " + name
+	}
+	return ""
+}
+
+// useDashboard reports whether tunnels should show the live dashboard.
+func useDashboard() bool {
+	return !noTUI && !output.IsJSON() && dashboard.IsTerminal(os.Stdout)
 }
 
 func printBanner() {
@@ -1,58 +1,83 @@
 package cmd
 
 import (
+	"cli/internal/config"
+	"cli/internal/output"
 	"cli/internal/session"
-	"fmt"
-	"os"
-	"os/signal"
-	"syscall"
+	"cli/internal/tunnel"
 
 	"github.com/spf13/cobra"
 )
 
-var Host string
-var Port string
+// sessionTunnel collects the session command's flags.
+var sessionTunnel config.Tunnel
 
 var sessionCmd = &cobra.Command{
-	Use:     "session",
-	Short:   "create a session",
-	Long:    "creates a session for expose port to internet",
-	Example: "selfgrok session --host <host> --port <port>",
-	Run: func(cmd *cobra.Command, args []string) {
-		if Port == "" {
-			fmt.Println("Please provide port for expose")
-			return
+	Use:   "session",
+	Short: "create a session",
+	Long:  "creates a session for expose port to internet",
+	Example: `selfgrok session --host <host> --port <port>
+selfgrok session --target unix:///var/run/docker.sock
+selfgrok session --target tls://localhost:8443 --tls-skip-verify
+selfgrok session --upstream 127.0.0.1:3000 --upstream 127.0.0.1:3001 --upstream-policy round-robin --health-check http --health-path /healthz`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := tunnel.Options(sessionTunnel)
+		if err != nil {
+			return usageError(cmd, "%v", err)
 		}
-
-		stop := make(chan os.Signal, 1)
-		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-
-		done := make(chan struct{})
-
-		go func() {
-			err := session.Start(Host, Port)
-			if err != nil {
-				fmt.Println("Session ended with error:", err)
-			} else {
-				fmt.Println("Session interrupted by server")
-			}
-			close(done)
-		}()
-
-		select {
-		case <-stop:
-			fmt.Println("\nSession interrupted by user.")
-
-		case <-done:
-			fmt.Println("Session ended.")
+		if err := session.CheckTarget(opts); err != nil {
+			return err
 		}
+		opts.Dashboard = useDashboard()
 
-		fmt.Println("Session created successfully")
+		if err := session.Start(opts); err != nil {
+			return err
+		}
+		output.Println("Session ended.")
+		return nil
 	},
 }
 
 func init() {
-	sessionCmd.Flags().StringVar(&Host, "host", "127.0.0.1", "Set host (default: 127.0.0.1)")
-	sessionCmd.Flags().StringVar(&Port, "port", "", "Set port")
+	sessionCmd.Flags().StringVar(&sessionTunnel.Host, "host", "127.0.0.1", "Set host (default: 127.0.0.1)")
+	sessionCmd.Flags().StringVar(&sessionTunnel.Port, "port", "", "Set port")
+	sessionCmd.Flags().StringVar(&sessionTunnel.Target, "target", "", "Local target URL instead of host:port (tcp://, unix://, tls://)")
+	sessionCmd.Flags().BoolVar(&sessionTunnel.TLSSkipVerify, "tls-skip-verify", false, "Skip certificate checks for tls:// targets")
+	sessionCmd.Flags().BoolVar(&sessionTunnel.Inspect, "inspect", false, "Capture inbound HTTP requests, headers and bodies included, for replay")
+	sessionCmd.Flags().StringVar(&sessionTunnel.Protocol, "protocol", "tcp", "Tunnel protocol (tcp, http, udp)")
+	sessionCmd.Flags().StringVar(&sessionTunnel.ProxyProtocol, "proxy-protocol", "", "Send a PROXY protocol header (v1, v2) to the local service")
+	sessionCmd.Flags().BoolVar(&sessionTunnel.AllowForward, "allow-forward", false, "Let forward sessions reach other ports on --host")
+	sessionCmd.Flags().StringVar(&sessionTunnel.Join, "join", "", "Join an existing session as another agent")
+	sessionCmd.Flags().StringVar(&sessionTunnel.Balance, "balance", "", "Spread streams across agents (round-robin, least-conns, sticky)")
+	sessionCmd.Flags().BoolVar(&sessionTunnel.Private, "private", false, "Never expose publicly; peers connect with the share token via selfgrok forward")
+	sessionCmd.Flags().StringVar(&sessionTunnel.BasicAuth, "basic-auth", "", "Require HTTP basic auth (user:password)")
+	sessionCmd.Flags().StringVar(&sessionTunnel.BearerToken, "bearer-token", "", "Require an Authorization: Bearer token")
+	sessionCmd.Flags().StringVar(&sessionTunnel.OAuthHeader, "oauth-header", "", "Require a header set by an upstream OAuth proxy")
+	sessionCmd.Flags().StringSliceVar(&sessionTunnel.OAuthProxies, "oauth-proxy", nil, "CIDRs the OAuth proxy connects from, required with --oauth-header")
+	sessionCmd.Flags().StringSliceVar(&sessionTunnel.AllowCIDRs, "allow-cidr", nil, "Only accept external connections from these CIDRs")
+	sessionCmd.Flags().StringSliceVar(&sessionTunnel.DenyCIDRs, "deny-cidr", nil, "Reject external connections from these CIDRs")
+	sessionCmd.Flags().Float64Var(&sessionTunnel.RateLimit, "rate-limit", 0, "Max new external connections per second")
+	sessionCmd.Flags().Float64Var(&sessionTunnel.RateLimitPerIP, "rate-limit-per-ip", 0, "Max new external connections per second from one IP")
+	sessionCmd.Flags().IntVar(&sessionTunnel.MaxConns, "max-conns", 0, "Max concurrent external connections")
+	sessionCmd.Flags().StringVar(&sessionTunnel.BandwidthUp, "bandwidth-up", "", "Max bytes/sec from the local service to clients (e.g. 512K, 10M)")
+	sessionCmd.Flags().StringVar(&sessionTunnel.BandwidthDown, "bandwidth-down", "", "Max bytes/sec from clients to the local service (e.g. 512K, 10M)")
+	sessionCmd.Flags().StringVar(&sessionTunnel.HostHeader, "host-header", "", "Host header sent to the local service (\"rewrite\" uses host:port)")
+	sessionCmd.Flags().StringArrayVar(&sessionTunnel.RequestHeaderAdd, "request-header-add", nil, "Add request header (\"Name: value\")")
+	sessionCmd.Flags().StringArrayVar(&sessionTunnel.RequestHeaderRemove, "request-header-remove", nil, "Remove request header")
+	sessionCmd.Flags().StringArrayVar(&sessionTunnel.ResponseHeaderAdd, "response-header-add", nil, "Add response header (\"Name: value\")")
+	sessionCmd.Flags().StringArrayVar(&sessionTunnel.ResponseHeaderRemove, "response-header-remove", nil, "Remove response header")
+	sessionCmd.Flags().StringVar(&sessionTunnel.ErrorPageHTML, "error-page-html", "", "HTML file for pages shown when the local service is unreachable")
+	sessionCmd.Flags().StringVar(&sessionTunnel.ErrorPageJSON, "error-page-json", "", "JSON file for error responses to clients accepting JSON")
+	sessionCmd.Flags().StringArrayVar(&sessionTunnel.Upstreams, "upstream", nil, "Local service to send streams to, repeat for several (replaces --host/--port/--target)")
+	sessionCmd.Flags().StringVar(&sessionTunnel.UpstreamPolicy, "upstream-policy", "failover", "Pick upstreams by failover or round-robin")
+	sessionCmd.Flags().StringVar(&sessionTunnel.HealthCheck, "health-check", "tcp", "Local health check (tcp, http)")
+	sessionCmd.Flags().StringVar(&sessionTunnel.HealthPath, "health-path", "/", "Path requested by http health checks")
+	sessionCmd.Flags().StringVar(&sessionTunnel.HealthInterval, "health-interval", "10s", "Time between health checks (off to disable)")
+	sessionCmd.Flags().StringVar(&sessionTunnel.DialTimeout, "dial-timeout", "", "Timeout for connecting to the local service (default 10s)")
+	sessionCmd.Flags().StringVar(&sessionTunnel.AgentWait, "agent-wait", "", "How long the server holds new connections while this CLI is offline or unhealthy (default 5s)")
+	sessionCmd.Flags().StringVar(&sessionTunnel.StreamIdleTimeout, "stream-idle-timeout", "", "Close connections without traffic for this long")
+	sessionCmd.Flags().StringVar(&sessionTunnel.StreamMaxLifetime, "stream-max-lifetime", "", "Close connections open for this long")
+	sessionCmd.Flags().StringVar(&sessionTunnel.SessionIdleTimeout, "session-idle-timeout", "", "Stop the session after this long without connections or traffic")
+	sessionCmd.Flags().IntVar(&sessionTunnel.MaxReconnects, "max-reconnects", 0, "Give up after this many failed reconnect attempts (0: never)")
 	rootCmd.AddCommand(sessionCmd)
 }
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"cli/internal/api"
+	"cli/internal/config"
+	"cli/internal/connector"
+	"cli/internal/dashboard"
+	"cli/internal/output"
+	"cli/internal/session"
+	"cli/internal/tunnel"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var startAll bool
+
+var startCmd = &cobra.Command{
+	Use:   "start [name...]",
+	Short: "start tunnels from the config file",
+	Long:  "brings up named tunnels from the tunnels section of ~/.selfgrok/config.yaml in one process",
+	Example: `selfgrok start web api
+selfgrok start --all`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+
+		names := args
+		if startAll {
+			names = nil
+			for name := range cfg.Tunnels {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		if len(names) == 0 {
+			return usageError(cmd, "name the tunnels to start or pass --all")
+		}
+
+		optsByName := make(map[string]session.Options, len(names))
+		for _, name := range names {
+			t, ok := cfg.Tunnels[name]
+			if !ok {
+				return usageError(cmd, "tunnel %q is not defined in the config file", name)
+			}
+			opts, err := tunnel.Options(t)
+			if err != nil {
+				return usageError(cmd, "tunnel %q: %v", name, err)
+			}
+			optsByName[name] = opts
+		}
+
+		var dash *dashboard.Dashboard
+		if useDashboard() {
+			dash = dashboard.New(os.Stdout)
+			for _, name := range names {
+				opts := optsByName[name]
+				opts.Stats = connector.NewStats()
+				opts.Log = log.New(dash, name+" ", log.LstdFlags)
+				optsByName[name] = opts
+			}
+		}
+
+		client, err := api.New()
+		if err != nil {
+			return fmt.Errorf("API client init failed: %w", err)
+		}
+
+		var tunnels []*session.Tunnel
+		var closing atomic.Bool // set on Ctrl-C, tunnels ending then are not errors
+		closeAll := func() {
+			for _, t := range tunnels {
+				t.Close()
+			}
+		}
+		for _, name := range names {
+			t, err := session.Open(client, optsByName[name])
+			if err != nil {
+				closeAll()
+				return fmt.Errorf("tunnel %q: %w", name, err)
+			}
+			tunnels = append(tunnels, t)
+			conn := t.Connection()
+			output.Printf("  %-12s %s:%d\n", name, conn.Address, conn.ExternalPort)
+		}
+
+		if dash != nil {
+			for i, t := range tunnels {
+				dash.Add(t.Dashboard(names[i]))
+			}
+			dash.Start()
+			defer dash.Stop()
+		}
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(stop)
+		go func() {
+			<-stop
+			if dash != nil {
+				dash.Stop()
+			}
+			output.Println("\nShutting down tunnels...")
+			closing.Store(true)
+			closeAll()
+		}()
+
+		var wg sync.WaitGroup
+		for i, t := range tunnels {
+			wg.Add(1)
+			go func(name string, t *session.Tunnel) {
+				defer wg.Done()
+				if err := t.Run(); err != nil && !closing.Load() {
+					if dash != nil {
+						fmt.Fprintf(dash, "Tunnel %q ended with error: %v\n", name, err)
+					} else {
+						output.Printf("Tunnel %q ended with error: %v\n", name, err)
+					}
+					output.Emit(output.Event{Type: output.EventError, Session: t.Connection().ID, Error: err.Error(), Code: output.ExitCode(err)})
+				}
+				t.Close()
+			}(names[i], t)
+		}
+		wg.Wait()
+		return nil
+	},
+}
+
+func init() {
+	startCmd.Flags().BoolVar(&startAll, "all", false, "Start every tunnel in the config file")
+	rootCmd.AddCommand(startCmd)
+}
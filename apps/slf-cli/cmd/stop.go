@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"cli/internal/daemon"
+	"cli/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+var stopCmd = &cobra.Command{
+	Use:     "stop <id|name>",
+	Short:   "stop a daemon tunnel",
+	Long:    "stops a tunnel run by the background daemon",
+	Example: "selfgrok stop web",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info, err := daemon.NewClient().Stop(args[0])
+		if err != nil {
+			return err
+		}
+		output.Result(map[string]any{"type": "tunnel_stopped", "tunnel": info})
+		output.Printf("Stopped %s (%s)\n", info.Name, info.ID)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stopCmd)
+}
@@ -23,10 +23,16 @@ func New() (*Client, error) {
 		return nil, fmt.Errorf("token or server URL not set in config")
 	}
 
+	return NewWith(cfg.ServerURL, cfg.Token), nil
+}
+
+// NewWith returns a client for serverURL authenticating with token,
+// regardless of the config file.
+func NewWith(serverURL, token string) *Client {
 	return &Client{
-		baseURL: cfg.ServerURL,
-		token:   cfg.Token,
-	}, nil
+		baseURL: serverURL,
+		token:   token,
+	}
 }
 
 func (c *Client) DoRequest(method, path string, body any) (*http.Response, error) {
@@ -6,8 +6,12 @@ import (
 	"net/http"
 )
 
-func (c *Client) CreateConnection() (*Connection, error) {
-	res, err := c.DoRequest(http.MethodPost, "/api/connection", nil)
+func (c *Client) CreateConnection(opts *ConnectionOptions) (*Connection, error) {
+	var body any
+	if opts != nil {
+		body = opts
+	}
+	res, err := c.DoRequest(http.MethodPost, "/api/connection", body)
 	if err != nil {
 		return nil, err
 	}
@@ -19,29 +23,56 @@ func (c *Client) CreateConnection() (*Connection, error) {
 	}
 
 	if !response.Success || response.Data == nil {
-		return nil, formatAPIError(response.Message, response.Error)
+		return nil, formatAPIError(res.StatusCode, response.Message, response.Error)
+	}
+
+	return response.Data, nil
+}
+
+// GetConnection fetches the current state of a session.
+func (c *Client) GetConnection(id string) (*Connection, error) {
+	res, err := c.DoRequest(http.MethodGet, "/api/connection/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var response ConnectionResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode connection response: %w", err)
+	}
+
+	if !response.Success || response.Data == nil {
+		return nil, formatAPIError(res.StatusCode, response.Message, response.Error)
 	}
 
 	return response.Data, nil
 }
 
-func (c *Client) UpdateConnection(id, status string) error {
+// UpdateConnection reports the session's status. active is false when the
+// session was already stopped and the report was ignored.
+func (c *Client) UpdateConnection(id, status string) (active bool, err error) {
 	res, err := c.DoRequest(http.MethodPatch, "/api/connection/"+id, map[string]interface{}{"status": status})
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer res.Body.Close()
 
-	var response GenericResponse
+	var response struct {
+		Success bool    `json:"success"`
+		Message string  `json:"message"`
+		Error   *string `json:"error,omitempty"`
+		Data    bool    `json:"data"`
+	}
 	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
-		return fmt.Errorf("failed to decode update response: %w", err)
+		return false, fmt.Errorf("failed to decode update response: %w", err)
 	}
 
 	if !response.Success {
-		return formatAPIError(response.Message, response.Error)
+		return false, formatAPIError(res.StatusCode, response.Message, response.Error)
 	}
 
-	return nil
+	return response.Data, nil
 }
 
 func (c *Client) DeleteConnection(id string) error {
@@ -57,15 +88,43 @@ func (c *Client) DeleteConnection(id string) error {
 	}
 
 	if !response.Success {
-		return formatAPIError(response.Message, response.Error)
+		return formatAPIError(res.StatusCode, response.Message, response.Error)
 	}
 
 	return nil
 }
 
-func formatAPIError(message string, apiErr *string) error {
+// Error is a failure reported by the backend API.
+type Error struct {
+	Status  int // HTTP status code
+	Message string
+	Code    string // e.g. unauthorized, no_ports_available, quota_exceeded
+}
+
+// NotFound reports whether the requested resource does not exist.
+func (e *Error) NotFound() bool {
+	return e.Status == http.StatusNotFound || e.Code == "connection_not_found"
+}
+
+// Unauthorized reports whether the API key was missing or rejected.
+func (e *Error) Unauthorized() bool {
+	return e.Status == http.StatusUnauthorized || e.Code == "unauthorized"
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Code
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("%s (%s)", e.Message, e.Code)
+	}
+	return e.Message
+}
+
+func formatAPIError(status int, message string, apiErr *string) error {
+	e := &Error{Status: status, Message: message}
 	if apiErr != nil {
-		return fmt.Errorf("%s (%s)", message, *apiErr)
+		e.Code = *apiErr
 	}
-	return fmt.Errorf("%s", message)
+	return e
 }
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Me checks the client's token against the backend.
+func (c *Client) Me() (*Me, error) {
+	res, err := c.DoRequest(http.MethodGet, "/api/me", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var response MeResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode me response: %w", err)
+	}
+
+	if !response.Success || response.Data == nil {
+		return nil, formatAPIError(res.StatusCode, response.Message, response.Error)
+	}
+
+	return response.Data, nil
+}
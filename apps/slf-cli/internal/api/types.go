@@ -1,11 +1,24 @@
 package api
 
+import "time"
+
 type Connection struct {
 	ID           string `json:"id"`
 	Address      string `json:"address"`
 	ExternalPort int    `json:"externalPort"`
 	InternalPort int    `json:"internalPort"`
 	Status       string `json:"status"`
+	ShareToken   string `json:"shareToken,omitempty"`  // private sessions only
+	AgentSecret  string `json:"agentSecret,omitempty"` // sent in the HELLO frame when attaching
+}
+
+// Active reports whether the session still holds its ports on slf-server.
+func (c *Connection) Active() bool {
+	switch c.Status {
+	case "connecting", "connected", "reconnecting":
+		return true
+	}
+	return false
 }
 
 type ConnectionResponse struct {
@@ -15,9 +28,87 @@ type ConnectionResponse struct {
 	Data    *Connection `json:"data"`
 }
 
+// Me describes the API key the client authenticates with.
+type Me struct {
+	APIKeyID  string    `json:"apiKeyId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Email     string    `json:"email,omitempty"`
+}
+
+type MeResponse struct {
+	Success bool    `json:"success"`
+	Message string  `json:"message"`
+	Error   *string `json:"error,omitempty"`
+	Data    *Me     `json:"data"`
+}
+
 type GenericResponse struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message"`
 	Error   *string     `json:"error,omitempty"`
 	Data    interface{} `json:"data"`
 }
+
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type AccessPolicy struct {
+	BasicAuth   *BasicAuth `json:"basicAuth,omitempty"`
+	BearerToken string     `json:"bearerToken,omitempty"`
+	OAuthHeader string     `json:"oauthHeader,omitempty"`
+	// OAuthProxies are the CIDRs the OAuth proxy connects from; the header
+	// is ignored on requests from anywhere else.
+	OAuthProxies []string `json:"oauthProxies,omitempty"`
+}
+
+type HeaderRules struct {
+	Host           string            `json:"host,omitempty"`
+	RequestAdd     map[string]string `json:"requestAdd,omitempty"`
+	RequestRemove  []string          `json:"requestRemove,omitempty"`
+	ResponseAdd    map[string]string `json:"responseAdd,omitempty"`
+	ResponseRemove []string          `json:"responseRemove,omitempty"`
+}
+
+// ErrorPages replace the pages slf-server shows when the local service is
+// unreachable; {{status}}, {{title}} and {{message}} are substituted.
+type ErrorPages struct {
+	HTML string `json:"html,omitempty"`
+	JSON string `json:"json,omitempty"`
+}
+
+type RateLimit struct {
+	ConnsPerSecond      float64 `json:"connsPerSecond,omitempty"`
+	PerIPConnsPerSecond float64 `json:"perIpConnsPerSecond,omitempty"`
+	MaxConns            int     `json:"maxConns,omitempty"`
+}
+
+type Bandwidth struct {
+	UpBytesPerSec   int64 `json:"upBytesPerSec,omitempty"`
+	DownBytesPerSec int64 `json:"downBytesPerSec,omitempty"`
+}
+
+// Timeouts override slf-server's session timeouts, as Go duration strings.
+type Timeouts struct {
+	AgentWait      string `json:"agentWait,omitempty"`
+	StreamIdle     string `json:"streamIdle,omitempty"`
+	StreamLifetime string `json:"streamLifetime,omitempty"`
+	SessionIdle    string `json:"sessionIdle,omitempty"`
+}
+
+// ConnectionOptions are forwarded to slf-server when the session starts.
+type ConnectionOptions struct {
+	Mode       string        `json:"mode,omitempty"`     // "" | forward | private
+	Protocol   string        `json:"protocol,omitempty"` // tcp | http | udp
+	Join       string        `json:"join,omitempty"`     // join an existing session as another agent
+	Balance    string        `json:"balance,omitempty"`  // round-robin | least-conns | sticky
+	Access     *AccessPolicy `json:"access,omitempty"`
+	Headers    *HeaderRules  `json:"headers,omitempty"`
+	ErrorPages *ErrorPages   `json:"errorPages,omitempty"`
+	AllowCIDRs []string      `json:"allowCidrs,omitempty"`
+	DenyCIDRs  []string      `json:"denyCidrs,omitempty"`
+	RateLimit  *RateLimit    `json:"rateLimit,omitempty"`
+	Bandwidth  *Bandwidth    `json:"bandwidth,omitempty"`
+	Timeouts   *Timeouts     `json:"timeouts,omitempty"`
+}
@@ -2,41 +2,194 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 
 	"gopkg.in/yaml.v2"
 )
 
+// Environment variables overriding the config file.
+const (
+	EnvToken     = "SELFGROK_TOKEN"
+	EnvServerURL = "SELFGROK_SERVER_URL"
+	EnvProfile   = "SELFGROK_PROFILE"
+	EnvStateDir  = "SELFGROK_STATE_DIR"
+)
+
+// Config is the config file. The top-level token and server URL form the
+// default profile. Tokens live in the credential store; a token in the
+// file is still honored for configs written by older versions.
 type Config struct {
-	Token     string `yaml:"token"`
+	Token     string             `yaml:"token,omitempty"`
+	ServerURL string             `yaml:"serverUrl"`
+	Profiles  map[string]Profile `yaml:"profiles,omitempty"`
+	Tunnels   map[string]Tunnel  `yaml:"tunnels,omitempty"`
+}
+
+// Profile is a named server and token, e.g. for a staging server.
+type Profile struct {
+	Token     string `yaml:"token,omitempty"`
 	ServerURL string `yaml:"serverUrl"`
 }
 
-func getConfigPath() string {
+var (
+	pathOverride string
+	profile      string
+	stateDir     string
+)
+
+// SetPath makes the config file live at path instead of the default.
+func SetPath(path string) {
+	pathOverride = path
+}
+
+// SetStateDir makes the CLI keep its state in dir, overriding
+// SELFGROK_STATE_DIR.
+func SetStateDir(dir string) {
+	stateDir = dir
+}
+
+// SetProfile selects the profile Load resolves, overriding SELFGROK_PROFILE.
+func SetProfile(name string) {
+	profile = name
+}
+
+// ProfileName returns the selected profile name, empty for the default one.
+func ProfileName() string {
+	if profile != "" {
+		return profile
+	}
+	return os.Getenv(EnvProfile)
+}
+
+// Args returns the global flags selecting this config, for re-running the
+// CLI in another process.
+func Args() []string {
+	var args []string
+	if pathOverride != "" {
+		args = append(args, "--config", pathOverride)
+	}
+	if profile != "" {
+		args = append(args, "--profile", profile)
+	}
+	if stateDir != "" {
+		args = append(args, "--state-dir", stateDir)
+	}
+	return args
+}
+
+// Dir returns the directory the CLI keeps its state in: the credentials
+// file, captures and the daemon's socket and log. It is the state dir when
+// one is set, else the directory of a config file given with SetPath, else
+// ~/.selfgrok.
+func Dir() (string, error) {
+	if dir := stateDir; dir != "" {
+		return filepath.Abs(dir)
+	}
+	if dir := os.Getenv(EnvStateDir); dir != "" {
+		return filepath.Abs(dir)
+	}
+	if pathOverride != "" {
+		return filepath.Abs(filepath.Dir(pathOverride))
+	}
+	return defaultDir()
+}
+
+func defaultDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		panic("cannot determine home directory: " + err.Error())
+		return "", fmt.Errorf("cannot determine home directory, pass --config or --state-dir: %w", err)
 	}
-	return filepath.Join(homeDir, ".selfgrok", "config.yaml")
+	return filepath.Join(homeDir, ".selfgrok"), nil
 }
 
-func Load() (*Config, error) {
-	path := getConfigPath()
+// Path returns the config file path.
+func Path() (string, error) {
+	if pathOverride != "" {
+		return pathOverride, nil
+	}
+	dir, err := defaultDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
 
+// Read returns the config file as stored, or an empty config when the
+// file does not exist yet.
+func Read() (*Config, error) {
+	var cfg Config
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
 	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &cfg, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-
-	var cfg Config
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
-
 	return &cfg, nil
 }
 
+// Save writes cfg to the config file.
+func Save(cfg *Config) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	// files written by older versions have default permissions
+	return os.Chmod(path, 0o600)
+}
+
+// Load returns the config with the selected profile and the environment
+// applied to its token and server URL.
+func Load() (*Config, error) {
+	cfg, err := Read()
+	if err != nil {
+		return nil, err
+	}
+
+	if name := ProfileName(); name != "" {
+		p, ok := cfg.Profiles[name]
+		if !ok {
+			path, _ := Path() // Read succeeded, so did Path
+			return nil, fmt.Errorf("profile %q is not defined in %s", name, path)
+		}
+		cfg.Token = p.Token
+		cfg.ServerURL = p.ServerURL
+	}
+	// the environment wins, so a broken credential store does not matter
+	if token := os.Getenv(EnvToken); token != "" {
+		cfg.Token = token
+	} else if cfg.Token == "" {
+		token, err := Token(ProfileName())
+		if err != nil && !errors.Is(err, ErrNoToken) {
+			return nil, err
+		}
+		cfg.Token = token
+	}
+	if url := os.Getenv(EnvServerURL); url != "" {
+		cfg.ServerURL = url
+	}
+	return cfg, nil
+}
+
 func Validate() error {
 	cfg, err := Load()
 	if err != nil {
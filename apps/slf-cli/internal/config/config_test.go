@@ -0,0 +1,52 @@
+package config_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"cli/internal/config"
+)
+
+func TestDir(t *testing.T) {
+	home := t.TempDir()
+	project := filepath.Join(home, "project")
+
+	tests := []struct {
+		name     string
+		home     string
+		path     string // --config
+		stateDir string // --state-dir
+		envDir   string // SELFGROK_STATE_DIR
+		want     string // empty when Dir must fail
+	}{
+		{name: "default", home: home, want: filepath.Join(home, ".selfgrok")},
+		{name: "next to config", home: home, path: filepath.Join(project, "selfgrok.yaml"), want: project},
+		{name: "env", home: home, path: filepath.Join(project, "selfgrok.yaml"), envDir: filepath.Join(home, "env"), want: filepath.Join(home, "env")},
+		{name: "flag over env", home: home, stateDir: filepath.Join(home, "flag"), envDir: filepath.Join(home, "env"), want: filepath.Join(home, "flag")},
+		{name: "no home", home: ""},
+		{name: "no home with config", home: "", path: filepath.Join(project, "selfgrok.yaml"), want: project},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", tt.home)
+			t.Setenv(config.EnvStateDir, tt.envDir)
+			config.SetPath(tt.path)
+			config.SetStateDir(tt.stateDir)
+			t.Cleanup(func() {
+				config.SetPath("")
+				config.SetStateDir("")
+			})
+
+			got, err := config.Dir()
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("Dir() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Dir() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zalando/go-keyring"
+)
+
+const keyringService = "selfgrok"
+
+// Where tokens are stored.
+const (
+	StoreKeyring = "keyring"
+	StoreFile    = "credentials file"
+)
+
+var ErrNoToken = errors.New("no token stored")
+
+// credentialKey names a profile's token in the keyring and the credentials
+// file. It includes the absolute config path, so the same profile name in
+// two config files, e.g. a project's --config, keeps two tokens.
+func credentialKey(profile string) (string, error) {
+	path, err := Path()
+	if err != nil {
+		return "", err
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return "", err
+	}
+	return legacyCredentialKey(profile) + "@" + path, nil
+}
+
+// legacyCredentialKey is the key older versions stored every config's
+// token under. It is still read for the default config file.
+func legacyCredentialKey(profile string) string {
+	if profile == "" {
+		return "default"
+	}
+	return profile
+}
+
+// SetToken stores the token of profile in the OS keyring, or in the
+// credentials file when no keyring is available, and reports which one was
+// used.
+func SetToken(profile, token string) (string, error) {
+	key, err := credentialKey(profile)
+	if err != nil {
+		return "", err
+	}
+	if err := keyring.Set(keyringService, key, token); err == nil {
+		_ = deleteFileToken(key)
+		return StoreKeyring, nil
+	}
+	return StoreFile, setFileToken(key, token)
+}
+
+// Token returns the stored token of profile, or ErrNoToken.
+func Token(profile string) (string, error) {
+	key, err := credentialKey(profile)
+	if err != nil {
+		return "", err
+	}
+	token, err := storedToken(key)
+	if errors.Is(err, ErrNoToken) && pathOverride == "" {
+		return storedToken(legacyCredentialKey(profile))
+	}
+	return token, err
+}
+
+func storedToken(key string) (string, error) {
+	if token, err := keyring.Get(keyringService, key); err == nil {
+		return token, nil
+	}
+	return fileToken(key)
+}
+
+// DeleteToken removes the stored token of profile from both stores.
+func DeleteToken(profile string) error {
+	key, err := credentialKey(profile)
+	if err != nil {
+		return err
+	}
+	keys := []string{key}
+	if pathOverride == "" {
+		keys = append(keys, legacyCredentialKey(profile))
+	}
+	for _, key := range keys {
+		_ = keyring.Delete(keyringService, key) // not stored, or no keyring
+		if err := deleteFileToken(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MaskToken hides all but the ends of token for display.
+func MaskToken(token string) string {
+	if len(token) <= 8 {
+		return "********"
+	}
+	return token[:4] + "…" + token[len(token)-4:]
+}
+
+// The credentials file maps profiles to AES-GCM sealed tokens. Its key is
+// kept in a separate file in the same directory, so the token is not in
+// plaintext in the config file and a credentials file copied on its own
+// does not leak it. Anyone who can read the directory can decrypt it; both
+// files are readable by the owner only.
+
+func credentialsPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "credentials"), nil
+}
+
+func credentialsKeyPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "credentials.key"), nil
+}
+
+// fileKey returns the key of the credentials file. A new key is only
+// created while the file holds no tokens: replacing the key of a
+// non-empty file would make its tokens unreadable.
+func fileKey(create bool) ([]byte, error) {
+	keyPath, err := credentialsKeyPath()
+	if err != nil {
+		return nil, err
+	}
+	key, err := os.ReadFile(keyPath)
+	if err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	creds, err := readCredentials()
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) > 0 {
+		return nil, fmt.Errorf("%s is missing or invalid, so the tokens in %s cannot be read; remove both and run selfgrok login again",
+			keyPath, filepath.Join(filepath.Dir(keyPath), "credentials"))
+	}
+	if !create {
+		return nil, ErrNoToken
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0o700); err != nil {
+		return nil, err
+	}
+	return key, os.WriteFile(keyPath, key, 0o600)
+}
+
+func readCredentials() (map[string]string, error) {
+	creds := make(map[string]string)
+	path, err := credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return creds, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+func writeCredentials(creds map[string]string) error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if len(creds) == 0 {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func setFileToken(name, token string) error {
+	key, err := fileKey(true)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(token), []byte(name))
+
+	creds, err := readCredentials()
+	if err != nil {
+		return err
+	}
+	creds[name] = base64.StdEncoding.EncodeToString(sealed)
+	return writeCredentials(creds)
+}
+
+func fileToken(name string) (string, error) {
+	creds, err := readCredentials()
+	if err != nil {
+		return "", err
+	}
+	enc, ok := creds[name]
+	if !ok {
+		return "", ErrNoToken
+	}
+	key, err := fileKey(false)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("credentials file is corrupt")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	token, err := gcm.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", errors.New("cannot decrypt stored token, run selfgrok login again")
+	}
+	return string(token), nil
+}
+
+func deleteFileToken(name string) error {
+	creds, err := readCredentials()
+	if err != nil {
+		return err
+	}
+	if _, ok := creds[name]; !ok {
+		return nil
+	}
+	delete(creds, name)
+	return writeCredentials(creds)
+}
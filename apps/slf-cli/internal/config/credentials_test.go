@@ -0,0 +1,109 @@
+package config_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"cli/internal/config"
+
+	"github.com/zalando/go-keyring"
+)
+
+// useStore points the config at a fresh home directory and selects the
+// keyring or, when no keyring is available, the credentials file.
+func useStore(t *testing.T, store string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(config.EnvStateDir, "")
+	config.SetPath("")
+	t.Cleanup(func() { config.SetPath("") })
+	if store == config.StoreKeyring {
+		keyring.MockInit()
+	} else {
+		keyring.MockInitWithError(errors.New("no keyring"))
+	}
+	return home
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	for _, store := range []string{config.StoreKeyring, config.StoreFile} {
+		t.Run(store, func(t *testing.T) {
+			useStore(t, store)
+
+			got, err := config.SetToken("staging", "tok-123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != store {
+				t.Errorf("SetToken stored in the %s, want the %s", got, store)
+			}
+			if token, err := config.Token("staging"); err != nil || token != "tok-123" {
+				t.Fatalf("Token = %q, %v, want tok-123", token, err)
+			}
+			if err := config.DeleteToken("staging"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := config.Token("staging"); !errors.Is(err, config.ErrNoToken) {
+				t.Fatalf("Token after DeleteToken: %v, want ErrNoToken", err)
+			}
+		})
+	}
+}
+
+func TestTokenIsolation(t *testing.T) {
+	for _, store := range []string{config.StoreKeyring, config.StoreFile} {
+		t.Run(store, func(t *testing.T) {
+			home := useStore(t, store)
+			project := filepath.Join(home, "project", "selfgrok.yaml")
+
+			set := []struct {
+				path    string
+				profile string
+				token   string
+			}{
+				{path: "", profile: "", token: "home-default"},
+				{path: "", profile: "staging", token: "home-staging"},
+				{path: project, profile: "", token: "project-default"},
+				{path: project, profile: "staging", token: "project-staging"},
+			}
+			for _, s := range set {
+				config.SetPath(s.path)
+				if _, err := config.SetToken(s.profile, s.token); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, s := range set {
+				config.SetPath(s.path)
+				if token, err := config.Token(s.profile); err != nil || token != s.token {
+					t.Errorf("Token(%q) in %q = %q, %v, want %q", s.profile, s.path, token, err, s.token)
+				}
+			}
+
+			config.SetPath(project)
+			if err := config.DeleteToken(""); err != nil {
+				t.Fatal(err)
+			}
+			config.SetPath("")
+			if token, err := config.Token(""); err != nil || token != "home-default" {
+				t.Errorf("deleting the project token removed the default one: %q, %v", token, err)
+			}
+		})
+	}
+}
+
+func TestTokenReadsLegacyKeyForDefaultConfig(t *testing.T) {
+	useStore(t, config.StoreKeyring)
+	if err := keyring.Set("selfgrok", "default", "old-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	if token, err := config.Token(""); err != nil || token != "old-token" {
+		t.Fatalf("Token = %q, %v, want the token stored by older versions", token, err)
+	}
+	config.SetPath(filepath.Join(t.TempDir(), "config.yaml"))
+	if _, err := config.Token(""); !errors.Is(err, config.ErrNoToken) {
+		t.Fatalf("another config file read the legacy token: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+// Tunnel describes one exposed local service, either from the session
+// command's flags or from the tunnels section of the config file.
+type Tunnel struct {
+	Host                 string   `yaml:"host,omitempty"`
+	Port                 string   `yaml:"port,omitempty"`
+	Target               string   `yaml:"target,omitempty"`
+	TLSSkipVerify        bool     `yaml:"tlsSkipVerify,omitempty"`
+	Inspect              bool     `yaml:"inspect"`
+	Protocol             string   `yaml:"protocol,omitempty"`
+	ProxyProtocol        string   `yaml:"proxyProtocol,omitempty"`
+	AllowForward         bool     `yaml:"allowForward,omitempty"`
+	Private              bool     `yaml:"private,omitempty"`
+	Join                 string   `yaml:"join,omitempty"`
+	Balance              string   `yaml:"balance,omitempty"`
+	BasicAuth            string   `yaml:"basicAuth,omitempty"`
+	BearerToken          string   `yaml:"bearerToken,omitempty"`
+	OAuthHeader          string   `yaml:"oauthHeader,omitempty"`
+	OAuthProxies         []string `yaml:"oauthProxies,omitempty"`
+	AllowCIDRs           []string `yaml:"allowCidrs,omitempty"`
+	DenyCIDRs            []string `yaml:"denyCidrs,omitempty"`
+	RateLimit            float64  `yaml:"rateLimit,omitempty"`
+	RateLimitPerIP       float64  `yaml:"rateLimitPerIp,omitempty"`
+	MaxConns             int      `yaml:"maxConns,omitempty"`
+	BandwidthUp          string   `yaml:"bandwidthUp,omitempty"`
+	BandwidthDown        string   `yaml:"bandwidthDown,omitempty"`
+	HostHeader           string   `yaml:"hostHeader,omitempty"`
+	RequestHeaderAdd     []string `yaml:"requestHeaderAdd,omitempty"`
+	RequestHeaderRemove  []string `yaml:"requestHeaderRemove,omitempty"`
+	ResponseHeaderAdd    []string `yaml:"responseHeaderAdd,omitempty"`
+	ResponseHeaderRemove []string `yaml:"responseHeaderRemove,omitempty"`
+	ErrorPageHTML        string   `yaml:"errorPageHtml,omitempty"` // page file
+	ErrorPageJSON        string   `yaml:"errorPageJson,omitempty"` // page file
+	MaxReconnects        int      `yaml:"maxReconnects,omitempty"`
+	Upstreams            []string `yaml:"upstreams,omitempty"`
+	UpstreamPolicy       string   `yaml:"upstreamPolicy,omitempty"`
+	HealthCheck          string   `yaml:"healthCheck,omitempty"`
+	HealthPath           string   `yaml:"healthPath,omitempty"`
+	HealthInterval       string   `yaml:"healthInterval,omitempty"`
+	DialTimeout          string   `yaml:"dialTimeout,omitempty"`
+	AgentWait            string   `yaml:"agentWait,omitempty"`
+	StreamIdleTimeout    string   `yaml:"streamIdleTimeout,omitempty"`
+	StreamMaxLifetime    string   `yaml:"streamMaxLifetime,omitempty"`
+	SessionIdleTimeout   string   `yaml:"sessionIdleTimeout,omitempty"`
+}
+
+// DefaultTunnel returns the settings a tunnel has unless told otherwise,
+// matching the session command's flag defaults.
+func DefaultTunnel() Tunnel {
+	return Tunnel{
+		Host:           "127.0.0.1",
+		Protocol:       "tcp",
+		HealthCheck:    "tcp",
+		HealthInterval: "10s",
+	}
+}
+
+func (t *Tunnel) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Tunnel
+	p := plain(DefaultTunnel())
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	*t = Tunnel(p)
+	return nil
+}
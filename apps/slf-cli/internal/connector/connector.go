@@ -2,21 +2,84 @@ package connector
 
 import (
 	"cli/internal/api"
+	"cli/internal/inspect"
+	"cli/internal/output"
+	"cli/internal/proxyproto"
+	"cli/internal/target"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 )
 
 const (
-	frameTypeConnect = 1
-	frameTypeData    = 2
-	frameTypeClose   = 3
+	frameTypeConnect  = 1
+	frameTypeData     = 2
+	frameTypeClose    = 3
+	frameTypeDatagram = 4 // one UDP datagram per frame
+	frameTypeOpen     = 5 // stream opened by this client, acked with CONNECT
+	frameTypeHealth   = 6 // health of the local service, stream 0
+	frameTypeHello    = 7 // first frame on the internal port, carries the agent secret
+	frameTypePing     = 8 // stream 0, echoed by the server as PONG
+	frameTypePong     = 9
 )
 
+// healthPoll is how often a link looks for local health changes to report.
+const healthPoll = time.Second
+
+// pingInterval is how often a link measures its round-trip time.
+const pingInterval = 5 * time.Second
+
+// HealthReporter tells whether the local service is up.
+type HealthReporter interface {
+	Health() (healthy bool, detail string)
+}
+
+// healthMeta is the payload of a HEALTH frame.
+type healthMeta struct {
+	Healthy bool   `json:"healthy"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// closeMeta is the payload of a CLOSE frame for a stream whose local dial
+// failed; slf-server picks the error page an HTTP client sees from it.
+type closeMeta struct {
+	Reason string `json:"reason"` // refused | timeout
+	Detail string `json:"detail,omitempty"`
+}
+
+func closePayload(err error) []byte {
+	meta := closeMeta{Reason: "refused", Detail: err.Error()}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		meta.Reason = "timeout"
+	}
+	payload, _ := json.Marshal(meta)
+	return payload
+}
+
+// helloMeta is the payload of a HELLO frame.
+type helloMeta struct {
+	Secret string `json:"secret"`
+}
+
+// sendHello authenticates a new server connection as an agent of conn's
+// session. The server closes connections that skip it.
+func sendHello(serverConn net.Conn, conn *api.Connection) error {
+	payload, _ := json.Marshal(helloMeta{Secret: conn.AgentSecret})
+	_ = serverConn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	defer serverConn.SetWriteDeadline(time.Time{})
+	return writeFrame(serverConn, frameTypeHello, 0, payload)
+}
+
+const maxDatagramSize = 65535
+
 type Frame struct {
 	Type     byte
 	StreamID uint32
@@ -26,150 +89,509 @@ type Frame struct {
 
 type stream struct {
 	conn  net.Conn
+	tap   io.WriteCloser
 	mu    sync.Mutex
 	ready chan struct{}
 }
 
-func ConnectAndRun(localTarget string, client *api.Client, conn *api.Connection) error {
+// connectMeta is the payload of a CONNECT frame, empty for older servers.
+type connectMeta struct {
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	LocalAddr  string `json:"localAddr,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`   // "udp" for datagram streams
+	TargetPort int    `json:"targetPort,omitempty"` // forwarded stream: dial this port on LocalTarget's host
+}
 
-	serverAddr := fmt.Sprintf("%s:%d", conn.Address, conn.InternalPort)
-	externalAddr := fmt.Sprintf("%s:%d", conn.Address, conn.ExternalPort)
+type Options struct {
+	LocalTarget   string // host:port, or a target URL when Dial is set
+	Inspect       bool   // record inbound HTTP requests for replay
+	ProxyProtocol string // v1 | v2, prepended to local connections when set
+	AllowForward  bool   // accept streams from forward sessions for other local ports
 
-	var serverConn net.Conn
-	var err error
+	// Dial, when set, replaces dialing LocalTarget for TCP streams, e.g. to
+	// serve them inside the CLI.
+	Dial func() (net.Conn, error)
+
+	// DialTimeout bounds dials to LocalTarget and forwarded ports,
+	// target.DefaultDialTimeout when zero.
+	DialTimeout time.Duration
+
+	// Log receives the tunnel's log lines, the standard logger when nil.
+	Log *log.Logger
+
+	// Stats, when set, collects counters for a status view.
+	Stats *Stats
+
+	// Health, when set, is reported to the server so it stops sending
+	// streams while the local service is down.
+	Health HealthReporter
+
+	Reconnect ReconnectPolicy
+	Stop      <-chan struct{} // closed to end the session for good
+}
+
+func (o Options) dialTimeout() time.Duration {
+	if o.DialTimeout > 0 {
+		return o.DialTimeout
+	}
+	return target.DefaultDialTimeout
+}
+
+func (o Options) logger() *log.Logger {
+	if o.Log != nil {
+		return o.Log
+	}
+	return log.Default()
+}
+
+// ConnectAndRun attaches to the session's internal port and carries its
+// streams. When the link drops it re-attaches to the same session, so the
+// public address stays the same, until opts.Stop is closed or the
+// reconnect policy gives up.
+func ConnectAndRun(opts Options, client *api.Client, conn *api.Connection) error {
+	logger := opts.logger()
+	policy := opts.Reconnect.withDefaults()
+
+	serverAddr := net.JoinHostPort(conn.Address, strconv.Itoa(conn.InternalPort))
+	externalAddr := net.JoinHostPort(conn.Address, strconv.Itoa(conn.ExternalPort))
+
+	stats := opts.Stats
+	defer stats.setState(StateClosed)
 
+	attached := false
+	failures := 0
 	for {
-		serverConn, err = net.Dial("tcp", serverAddr)
+		if attached || failures > 0 {
+			if err := checkActive(client, conn.ID, logger); err != nil {
+				return err
+			}
+		}
+
+		dialStart := time.Now()
+		serverConn, err := net.DialTimeout("tcp", serverAddr, dialTimeout)
 		if err == nil {
-			break
+			if err = sendHello(serverConn, conn); err != nil {
+				serverConn.Close()
+			}
+		}
+		if err != nil {
+			failures++
+			if policy.MaxAttempts > 0 && failures >= policy.MaxAttempts {
+				return fmt.Errorf("giving up after %d attempts: %w", failures, err)
+			}
+			delay := policy.backoff(failures)
+			prefix := "[connect]"
+			if attached {
+				prefix = "[reconnect]"
+			}
+			logger.Printf("%s attempt %d failed: %v, retrying in %s", prefix, failures, err, delay.Round(time.Millisecond))
+			select {
+			case <-opts.Stop:
+				return nil
+			case <-time.After(delay):
+			}
+			continue
+		}
+		failures = 0
+		stats.setConnectTime(time.Since(dialStart))
+
+		if !attached {
+			if conn.ShareToken != "" {
+				logger.Printf("Private session initialized, peers can connect with: selfgrok forward --remote %s --share-token %s --local <addr>", conn.ID, conn.ShareToken)
+			} else {
+				logger.Printf("Connection initialized, you can access your app on: %s", externalAddr)
+			}
+		} else {
+			logger.Printf("[reconnect] re-attached to session %s", conn.ID)
+		}
+		attached = true
+		stats.setState(StateConnected)
+		if err := reportStatus(client, conn.ID, "connected", logger); err != nil {
+			serverConn.Close()
+			return err
+		}
+		output.Emit(output.Event{Type: output.EventConnected, Session: conn.ID, Address: externalAddr})
+
+		err = newLink(opts, serverConn).run()
+
+		select {
+		case <-opts.Stop:
+			return nil
+		default:
 		}
+		logger.Printf("[reconnect] connection lost: %v", err)
+		stats.setState(StateReconnecting)
+		if err := reportStatus(client, conn.ID, "reconnecting", logger); err != nil {
+			return err
+		}
+		output.Emit(output.Event{Type: output.EventReconnecting, Session: conn.ID, Error: errString(err)})
+	}
+}
+
+// checkActive asks the API whether the session may still be served, so a
+// stopped, expired or over-quota session is not redialed forever. An
+// unreachable API does not stop the tunnel.
+func checkActive(client *api.Client, id string, logger *log.Logger) error {
+	conn, err := client.GetConnection(id)
+	var apiErr *api.Error
+	switch {
+	case errors.As(err, &apiErr) && apiErr.NotFound():
+		return fmt.Errorf("session %s no longer exists", id)
+	case err != nil:
+		logger.Printf("[reconnect] could not check session status: %v", err)
+		return nil
+	case !conn.Active():
+		return fmt.Errorf("session %s is %s", id, conn.Status)
+	}
+	return nil
+}
 
-		time.Sleep(1 * time.Second)
+// reportStatus updates the session's status and fails when the API says
+// the session is no longer active.
+func reportStatus(client *api.Client, id, status string, logger *log.Logger) error {
+	active, err := client.UpdateConnection(id, status)
+	if err != nil {
+		logger.Printf("[status] failed to report %s: %v", status, err)
+		return nil
 	}
+	if !active {
+		return fmt.Errorf("session %s was stopped", id)
+	}
+	return nil
+}
 
-	defer serverConn.Close()
-	log.Printf("Connection initialized, you can access your app on: %s", externalAddr)
-	client.UpdateConnection(conn.ID, "connected")
+// link is one attachment of the CLI to its session.
+type link struct {
+	opts       Options
+	logger     *log.Logger
+	serverConn net.Conn
+	streams    map[uint32]*stream
+	mu         sync.RWMutex
+	writeQueue chan *Frame
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
 
-	streams := make(map[uint32]*stream)
-	var mu sync.RWMutex
-	writeQueue := make(chan *Frame, 1000)
+func newLink(opts Options, serverConn net.Conn) *link {
+	return &link{
+		opts:       opts,
+		logger:     opts.logger(),
+		serverConn: serverConn,
+		streams:    make(map[uint32]*stream),
+		writeQueue: make(chan *Frame, 1000),
+		done:       make(chan struct{}),
+	}
+}
 
-	go writeLoop(serverConn, writeQueue)
+// run serves the link until the server connection fails or opts.Stop is
+// closed, then closes every local stream it carried.
+func (l *link) run() error {
+	logger := l.logger
+	go writeLoop(l.serverConn, l.writeQueue, logger)
 
 	go func() {
-		for {
-			f, err := readFrame(serverConn)
-			if err != nil {
-				log.Printf("[readFrame] error: %v", err)
-				break
+		select {
+		case <-l.opts.Stop:
+		case <-l.done:
+		}
+		l.serverConn.Close()
+	}()
+	if l.opts.Health != nil {
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			l.reportHealth()
+		}()
+	}
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		l.ping()
+	}()
+
+	var err error
+	for {
+		var f *Frame
+		f, err = readFrame(l.serverConn)
+		if err != nil {
+			break
+		}
+
+		logger.Printf("[client] got frame: type=%d streamID=%d length=%d", f.Type, f.StreamID, f.Length)
+
+		switch f.Type {
+		case frameTypePong:
+			if len(f.Payload) == 8 {
+				sent := time.Unix(0, int64(binary.BigEndian.Uint64(f.Payload)))
+				l.opts.Stats.setRTT(time.Since(sent))
 			}
 
-			log.Printf("[client] got frame: type=%d streamID=%d length=%d", f.Type, f.StreamID, f.Length)
-
-			switch f.Type {
-			case frameTypeConnect:
-				log.Printf("[connect] new streamID %d", f.StreamID)
-				go handleConnect(f.StreamID, streams, &mu, writeQueue, localTarget)
-
-			case frameTypeData:
-				mu.RLock()
-				str, ok := streams[f.StreamID]
-				mu.RUnlock()
-				if !ok {
-					time.Sleep(10 * time.Millisecond)
-					mu.RLock()
-					str, ok = streams[f.StreamID]
-					mu.RUnlock()
+		case frameTypeConnect:
+			var meta connectMeta
+			if len(f.Payload) > 0 {
+				if err := json.Unmarshal(f.Payload, &meta); err != nil {
+					logger.Printf("[connect] stream %d invalid metadata: %v", f.StreamID, err)
+				}
+			}
+			logger.Printf("[connect] new streamID %d from %s", f.StreamID, meta.RemoteAddr)
+			l.wg.Add(1)
+			go func() {
+				defer l.wg.Done()
+				l.handleConnect(f.StreamID, meta)
+			}()
+
+		case frameTypeData, frameTypeDatagram:
+			l.mu.RLock()
+			str, ok := l.streams[f.StreamID]
+			l.mu.RUnlock()
+			if !ok {
+				time.Sleep(10 * time.Millisecond)
+				l.mu.RLock()
+				str, ok = l.streams[f.StreamID]
+				l.mu.RUnlock()
+			}
+			if ok {
+				<-str.ready
+				if str.conn == nil {
+					continue
+				}
+				str.mu.Lock()
+				n, err := str.conn.Write(f.Payload)
+				if err == nil && str.tap != nil {
+					_, _ = str.tap.Write(f.Payload)
 				}
-				if ok {
-					<-str.ready
-					str.mu.Lock()
-					n, err := str.conn.Write(f.Payload)
-					str.mu.Unlock()
-					if err != nil {
-						log.Printf("[data] stream %d write error: %v", f.StreamID, err)
-					} else {
-						log.Printf("[data] wrote %d bytes to local service for stream %d", n, f.StreamID)
-					}
+				str.mu.Unlock()
+				l.opts.Stats.addIn(f.StreamID, n)
+				if err != nil {
+					logger.Printf("[data] stream %d write error: %v", f.StreamID, err)
 				} else {
-					log.Printf("[data] stream %d not found", f.StreamID)
+					logger.Printf("[data] wrote %d bytes to local service for stream %d", n, f.StreamID)
 				}
+			} else {
+				logger.Printf("[data] stream %d not found", f.StreamID)
+			}
 
-			case frameTypeClose:
-				mu.Lock()
-				if str, ok := streams[f.StreamID]; ok {
-					<-str.ready
-					if str.conn != nil {
-						str.conn.Close()
-					}
-					delete(streams, f.StreamID)
-					log.Printf("[close] stream %d closed by server", f.StreamID)
+		case frameTypeClose:
+			l.mu.Lock()
+			if str, ok := l.streams[f.StreamID]; ok {
+				<-str.ready
+				if str.conn != nil {
+					str.conn.Close()
+				}
+				if str.tap != nil {
+					str.tap.Close()
 				}
-				mu.Unlock()
+				delete(l.streams, f.StreamID)
+				logger.Printf("[close] stream %d closed by server", f.StreamID)
+			}
+			l.mu.Unlock()
+
+		default:
+			logger.Printf("unknown frame type: %d", f.Type)
+		}
+	}
 
-			default:
-				log.Printf("unknown frame type: %d", f.Type)
+	close(l.done)
+	l.mu.Lock()
+	for id, str := range l.streams {
+		select {
+		case <-str.ready:
+			if str.conn != nil {
+				str.conn.Close()
 			}
+		default:
 		}
-	}()
+		delete(l.streams, id)
+	}
+	l.mu.Unlock()
+
+	l.wg.Wait()
+	close(l.writeQueue)
+	return err
+}
 
-	select {}
+// reportHealth sends the local service's health when the link comes up
+// and whenever it changes, until the link is done.
+func (l *link) reportHealth() {
+	ticker := time.NewTicker(healthPoll)
+	defer ticker.Stop()
+
+	first := true
+	var last bool
+	for {
+		healthy, detail := l.opts.Health.Health()
+		if first || healthy != last {
+			payload, _ := json.Marshal(healthMeta{Healthy: healthy, Detail: detail})
+			select {
+			case l.writeQueue <- &Frame{Type: frameTypeHealth, Payload: payload, Length: uint32(len(payload))}:
+			case <-l.done:
+				return
+			}
+			first, last = false, healthy
+		}
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
-func handleConnect(streamID uint32, streams map[uint32]*stream, mu *sync.RWMutex, writeQueue chan *Frame, localTarget string) {
+// ping sends a PING carrying its send time every pingInterval, until the
+// link is done. The server echoes it as PONG, which sets the link's RTT.
+// Servers without PING support ignore it and the RTT stays unknown.
+func (l *link) ping() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		payload := binary.BigEndian.AppendUint64(nil, uint64(time.Now().UnixNano()))
+		select {
+		case l.writeQueue <- &Frame{Type: frameTypePing, Payload: payload, Length: uint32(len(payload))}:
+		case <-l.done:
+			return
+		}
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *link) handleConnect(streamID uint32, meta connectMeta) {
+	opts := l.opts
+	logger := l.logger
+	localTarget := opts.LocalTarget
+	if meta.TargetPort != 0 {
+		if !opts.AllowForward {
+			logger.Printf("refusing forwarded stream %d to port %d, run with --allow-forward", streamID, meta.TargetPort)
+			l.writeQueue <- &Frame{Type: frameTypeClose, StreamID: streamID}
+			return
+		}
+		host, _, err := net.SplitHostPort(localTarget)
+		if err != nil {
+			logger.Printf("refusing forwarded stream %d: target %s has no host", streamID, localTarget)
+			l.writeQueue <- &Frame{Type: frameTypeClose, StreamID: streamID}
+			return
+		}
+		localTarget = net.JoinHostPort(host, strconv.Itoa(meta.TargetPort))
+	}
+
 	str := &stream{ready: make(chan struct{})}
-	mu.Lock()
-	streams[streamID] = str
-	mu.Unlock()
+	l.mu.Lock()
+	l.streams[streamID] = str
+	l.mu.Unlock()
+
+	udp := meta.Protocol == "udp"
+	network, dataType, bufSize := "tcp", byte(frameTypeData), 4096
+	if udp {
+		network, dataType, bufSize = "udp", frameTypeDatagram, maxDatagramSize
+	}
 
-	localConn, err := net.Dial("tcp", localTarget)
+	var localConn net.Conn
+	var err error
+	if opts.Dial != nil && !udp && meta.TargetPort == 0 {
+		localConn, err = opts.Dial()
+	} else {
+		localConn, err = net.DialTimeout(network, localTarget, opts.dialTimeout())
+	}
 	if err != nil {
-		log.Printf("failed to connect to local service: %v", err)
-		writeQueue <- &Frame{Type: frameTypeClose, StreamID: streamID}
-		mu.Lock()
-		delete(streams, streamID)
-		mu.Unlock()
+		logger.Printf("failed to connect to local service: %v", err)
+		output.Emit(output.Event{Type: output.EventError, Stream: streamID, Error: err.Error(), Code: output.ExitTargetDown})
+		close(str.ready)
+		payload := closePayload(err)
+		l.writeQueue <- &Frame{Type: frameTypeClose, StreamID: streamID, Payload: payload, Length: uint32(len(payload))}
+		l.mu.Lock()
+		delete(l.streams, streamID)
+		l.mu.Unlock()
 		return
 	}
 
+	if opts.ProxyProtocol != "" && !udp {
+		header, err := proxyproto.Header(opts.ProxyProtocol, meta.RemoteAddr, meta.LocalAddr)
+		if err == nil {
+			_, err = localConn.Write(header)
+		}
+		if err != nil {
+			// without the header the service would take the stream for a
+			// direct connection, so it is not carried at all
+			logger.Printf("failed to send PROXY header for stream %d: %v", streamID, err)
+			localConn.Close()
+			close(str.ready)
+			l.writeQueue <- &Frame{Type: frameTypeClose, StreamID: streamID}
+			l.mu.Lock()
+			delete(l.streams, streamID)
+			l.mu.Unlock()
+			return
+		}
+	}
+
 	str.conn = localConn
+	if opts.Inspect && !udp {
+		str.tap = inspect.Tap(streamID, localTarget, logger)
+	}
 	close(str.ready)
-	log.Printf("connected stream %d to local %s", streamID, localTarget)
 
-	buf := make([]byte, 4096)
+	// the link may have dropped while dialing
+	select {
+	case <-l.done:
+		localConn.Close()
+	default:
+	}
+	logger.Printf("connected %s stream %d to local %s", network, streamID, localTarget)
+	opts.Stats.streamOpened(streamID, meta.RemoteAddr)
+	output.Emit(output.Event{Type: output.EventStreamOpened, Stream: streamID, Remote: meta.RemoteAddr})
+
+	buf := make([]byte, bufSize)
 	for {
 		n, err := localConn.Read(buf)
 		if err != nil {
-			log.Printf("[local→server] stream %d read error: %v", streamID, err)
+			logger.Printf("[local→server] stream %d read error: %v", streamID, err)
 			break
 		}
 
 		copyBuf := make([]byte, n)
 		copy(copyBuf, buf[:n])
-		writeQueue <- &Frame{
-			Type:     frameTypeData,
+		l.writeQueue <- &Frame{
+			Type:     dataType,
 			StreamID: streamID,
 			Payload:  copyBuf,
 			Length:   uint32(n),
 		}
-		log.Printf("[writeFrame] queued %d bytes to server for stream %d", n, streamID)
+		opts.Stats.addOut(streamID, n)
+		logger.Printf("[writeFrame] queued %d bytes to server for stream %d", n, streamID)
 	}
 
-	writeQueue <- &Frame{Type: frameTypeClose, StreamID: streamID}
+	l.writeQueue <- &Frame{Type: frameTypeClose, StreamID: streamID}
 	localConn.Close()
+	if str.tap != nil {
+		str.tap.Close()
+	}
 
-	mu.Lock()
-	delete(streams, streamID)
-	mu.Unlock()
-	log.Printf("closed stream %d (from local)", streamID)
+	l.mu.Lock()
+	delete(l.streams, streamID)
+	l.mu.Unlock()
+	logger.Printf("closed stream %d (from local)", streamID)
+	opts.Stats.streamClosed(streamID)
+	output.Emit(output.Event{Type: output.EventStreamClosed, Stream: streamID, Remote: meta.RemoteAddr})
 }
 
-func writeLoop(w io.Writer, queue <-chan *Frame) {
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// writeLoop writes queued frames until the queue is closed. After a write
+// error the remaining frames are discarded so senders never block.
+func writeLoop(w io.Writer, queue <-chan *Frame, logger *log.Logger) {
 	for f := range queue {
 		err := writeFrame(w, f.Type, f.StreamID, f.Payload)
 		if err != nil {
-			log.Printf("[writeLoop] error writing frame: %v", err)
+			logger.Printf("[writeLoop] error writing frame: %v", err)
+			for range queue {
+			}
 			return
 		}
 	}
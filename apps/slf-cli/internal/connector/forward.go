@@ -0,0 +1,297 @@
+package connector
+
+import (
+	"cli/internal/api"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const openTimeout = 15 * time.Second
+
+type ForwardOptions struct {
+	Local      string
+	Remote     string      // "<session>", "<session>:<port>" or "<host>:<port>"
+	ShareToken string      // required when Remote is a private session
+	Log        *log.Logger // defaults to the standard logger
+
+	Reconnect ReconnectPolicy
+	Stop      <-chan struct{} // closed to end the forward for good
+}
+
+func (o ForwardOptions) logger() *log.Logger {
+	if o.Log != nil {
+		return o.Log
+	}
+	return log.Default()
+}
+
+// openMeta is the payload of an OPEN frame.
+type openMeta struct {
+	Target     string `json:"target"`
+	ShareToken string `json:"shareToken,omitempty"`
+}
+
+// forwardStream is a local connection carried to a remote target.
+type forwardStream struct {
+	conn  net.Conn
+	acked chan bool
+}
+
+// Forward listens on opts.Local and carries every accepted connection to
+// opts.Remote through a forward session, like ssh -L. The remote is another
+// session's service, a port on another CLI's host, or a host:port
+// reachable from slf-server. When the server connection drops, Forward
+// redials it with the reconnect policy while the listener stays open, until
+// opts.Stop is closed or the policy gives up.
+func Forward(opts ForwardOptions, client *api.Client, conn *api.Connection) error {
+	logger := opts.logger()
+	policy := opts.Reconnect.withDefaults()
+	serverAddr := net.JoinHostPort(conn.Address, strconv.Itoa(conn.InternalPort))
+
+	ln, err := net.Listen("tcp", opts.Local)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", opts.Local, err)
+	}
+	defer ln.Close()
+	go func() {
+		<-opts.Stop
+		ln.Close()
+	}()
+
+	// current is the link new connections are carried on, nil while the
+	// server connection is down
+	var current *forwardLink
+	var currentMu sync.Mutex
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				logger.Printf("[forward] listener stopped: %v", err)
+				return
+			}
+			currentMu.Lock()
+			l := current
+			currentMu.Unlock()
+			if l == nil || !l.carry(c) {
+				logger.Printf("[forward] refusing %s: not connected to the server", c.RemoteAddr())
+				c.Close()
+			}
+		}
+	}()
+
+	attached := false
+	failures := 0
+	for {
+		if attached || failures > 0 {
+			if err := checkActive(client, conn.ID, logger); err != nil {
+				return err
+			}
+		}
+
+		serverConn, err := net.DialTimeout("tcp", serverAddr, dialTimeout)
+		if err == nil {
+			if err = sendHello(serverConn, conn); err != nil {
+				serverConn.Close()
+			}
+		}
+		if err != nil {
+			failures++
+			if policy.MaxAttempts > 0 && failures >= policy.MaxAttempts {
+				return fmt.Errorf("giving up after %d attempts: %w", failures, err)
+			}
+			delay := policy.backoff(failures)
+			logger.Printf("[forward] attempt %d failed: %v, retrying in %s", failures, err, delay.Round(time.Millisecond))
+			select {
+			case <-opts.Stop:
+				return nil
+			case <-time.After(delay):
+			}
+			continue
+		}
+		failures = 0
+
+		if !attached {
+			logger.Printf("Forwarding %s to %s", ln.Addr(), opts.Remote)
+		} else {
+			logger.Printf("[forward] re-attached to session %s", conn.ID)
+		}
+		attached = true
+		if err := reportStatus(client, conn.ID, "connected", logger); err != nil {
+			serverConn.Close()
+			return err
+		}
+
+		l := newForwardLink(opts, serverConn)
+		currentMu.Lock()
+		current = l
+		currentMu.Unlock()
+
+		err = l.run()
+
+		currentMu.Lock()
+		current = nil
+		currentMu.Unlock()
+
+		select {
+		case <-opts.Stop:
+			return nil
+		default:
+		}
+		logger.Printf("[forward] server connection lost: %v", err)
+		if err := reportStatus(client, conn.ID, "reconnecting", logger); err != nil {
+			return err
+		}
+	}
+}
+
+// forwardLink is one attachment of a forward session to the server.
+type forwardLink struct {
+	opts       ForwardOptions
+	logger     *log.Logger
+	serverConn net.Conn
+	streams    map[uint32]*forwardStream
+	mu         sync.Mutex
+	writeQueue chan *Frame
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+func newForwardLink(opts ForwardOptions, serverConn net.Conn) *forwardLink {
+	return &forwardLink{
+		opts:       opts,
+		logger:     opts.logger(),
+		serverConn: serverConn,
+		streams:    make(map[uint32]*forwardStream),
+		writeQueue: make(chan *Frame, 1000),
+		done:       make(chan struct{}),
+	}
+}
+
+// run serves the link until the server connection fails or opts.Stop is
+// closed, then closes every local connection it carried.
+func (l *forwardLink) run() error {
+	go writeLoop(l.serverConn, l.writeQueue, l.logger)
+	go func() {
+		select {
+		case <-l.opts.Stop:
+		case <-l.done:
+		}
+		l.serverConn.Close()
+	}()
+
+	var err error
+	for {
+		var f *Frame
+		f, err = readFrame(l.serverConn)
+		if err != nil {
+			break
+		}
+
+		l.mu.Lock()
+		st, ok := l.streams[f.StreamID]
+		if ok && f.Type == frameTypeClose {
+			delete(l.streams, f.StreamID)
+		}
+		l.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		switch f.Type {
+		case frameTypeConnect:
+			st.acked <- true
+		case frameTypeData:
+			if _, err := st.conn.Write(f.Payload); err != nil {
+				l.logger.Printf("[forward] stream %d write error: %v", f.StreamID, err)
+			}
+		case frameTypeClose:
+			select {
+			case st.acked <- false:
+			default:
+			}
+			st.conn.Close()
+		}
+	}
+
+	l.mu.Lock()
+	close(l.done)
+	for id, st := range l.streams {
+		st.conn.Close()
+		delete(l.streams, id)
+	}
+	l.mu.Unlock()
+
+	l.wg.Wait()
+	close(l.writeQueue)
+	return err
+}
+
+// carry opens a stream for c on the link and reports false when the link
+// is already done.
+func (l *forwardLink) carry(c net.Conn) bool {
+	streamID := rand.Uint32()
+	st := &forwardStream{conn: c, acked: make(chan bool, 1)}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.done:
+		return false
+	default:
+	}
+	l.streams[streamID] = st
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		l.forwardConn(streamID, st)
+	}()
+	return true
+}
+
+func (l *forwardLink) forwardConn(streamID uint32, st *forwardStream) {
+	c := st.conn
+	defer c.Close()
+	opts := l.opts
+
+	payload, _ := json.Marshal(openMeta{Target: opts.Remote, ShareToken: opts.ShareToken})
+	l.writeQueue <- &Frame{Type: frameTypeOpen, StreamID: streamID, Length: uint32(len(payload)), Payload: payload}
+
+	var ok bool
+	select {
+	case ok = <-st.acked:
+	case <-l.done:
+	case <-time.After(openTimeout):
+	}
+	if !ok {
+		l.logger.Printf("[forward] %s refused stream to %s", c.RemoteAddr(), opts.Remote)
+		l.writeQueue <- &Frame{Type: frameTypeClose, StreamID: streamID}
+		l.mu.Lock()
+		delete(l.streams, streamID)
+		l.mu.Unlock()
+		return
+	}
+	l.logger.Printf("[forward] stream %d opened for %s", streamID, c.RemoteAddr())
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.Read(buf)
+		if err != nil {
+			break
+		}
+		copyBuf := make([]byte, n)
+		copy(copyBuf, buf[:n])
+		l.writeQueue <- &Frame{Type: frameTypeData, StreamID: streamID, Length: uint32(n), Payload: copyBuf}
+	}
+
+	l.writeQueue <- &Frame{Type: frameTypeClose, StreamID: streamID}
+	l.mu.Lock()
+	delete(l.streams, streamID)
+	l.mu.Unlock()
+	l.logger.Printf("[forward] stream %d closed", streamID)
+}
@@ -0,0 +1,40 @@
+package connector
+
+import (
+	"math/rand"
+	"time"
+)
+
+const dialTimeout = 10 * time.Second
+
+// ReconnectPolicy controls how the CLI re-attaches to its session after
+// the link to the server drops. Zero values pick the defaults.
+type ReconnectPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	MaxAttempts  int // consecutive failed dials before giving up, zero for unlimited
+}
+
+func (p ReconnectPolicy) withDefaults() ReconnectPolicy {
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = 500 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 30 * time.Second
+	}
+	return p
+}
+
+// backoff returns the delay before the given attempt: exponential growth
+// capped at MaxDelay, with the upper half jittered so many CLIs do not
+// hammer the server in lockstep.
+func (p ReconnectPolicy) backoff(attempt int) time.Duration {
+	d := p.MaxDelay
+	if attempt < 32 {
+		if exp := p.InitialDelay << (attempt - 1); exp > 0 && exp < d {
+			d = exp
+		}
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,40 @@
+package connector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  ReconnectPolicy
+		attempt int
+		max     time.Duration // delays fall in [max/2, max]
+	}{
+		{name: "first attempt", attempt: 1, max: 500 * time.Millisecond},
+		{name: "doubles", attempt: 3, max: 2 * time.Second},
+		{name: "capped by default", attempt: 8, max: 30 * time.Second},
+		{name: "shift overflow", attempt: 64, max: 30 * time.Second},
+		{name: "custom initial", policy: ReconnectPolicy{InitialDelay: time.Second}, attempt: 2, max: 2 * time.Second},
+		{name: "custom cap", policy: ReconnectPolicy{InitialDelay: time.Second, MaxDelay: 5 * time.Second}, attempt: 4, max: 5 * time.Second},
+		{name: "cap below initial", policy: ReconnectPolicy{InitialDelay: 10 * time.Second, MaxDelay: 3 * time.Second}, attempt: 1, max: 3 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.policy.withDefaults()
+			seen := make(map[time.Duration]bool)
+			for i := 0; i < 200; i++ {
+				d := p.backoff(tt.attempt)
+				if d < tt.max/2 || d > tt.max {
+					t.Fatalf("backoff(%d) = %s, want within [%s, %s]", tt.attempt, d, tt.max/2, tt.max)
+				}
+				seen[d] = true
+			}
+			// jitter spreads CLIs reconnecting at the same time
+			if len(seen) < 2 {
+				t.Errorf("backoff(%d) returned %s every time, want jitter", tt.attempt, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package connector
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Connection states reported by Stats.
+const (
+	StateConnecting   = "connecting"
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+	StateClosed       = "closed"
+)
+
+const maxRecentConns = 10
+
+// ConnInfo describes one external connection carried by the tunnel.
+type ConnInfo struct {
+	Stream   uint32
+	Remote   string
+	Opened   time.Time
+	Closed   time.Time // zero while open
+	BytesIn  uint64
+	BytesOut uint64
+}
+
+// Duration returns how long the connection has been, or was, open.
+func (c ConnInfo) Duration() time.Duration {
+	if c.Closed.IsZero() {
+		return time.Since(c.Opened)
+	}
+	return c.Closed.Sub(c.Opened)
+}
+
+// Stats collects a tunnel's counters while it runs. It is safe for
+// concurrent use and may be read while the connector updates it.
+type Stats struct {
+	bytesIn  atomic.Uint64 // server → local service
+	bytesOut atomic.Uint64 // local service → server
+
+	mu      sync.Mutex
+	state   string
+	connect time.Duration
+	rtt     time.Duration
+	active  map[uint32]*ConnInfo
+	recent  []ConnInfo // closed connections, newest last
+	streams uint64
+}
+
+func NewStats() *Stats {
+	return &Stats{state: StateConnecting, active: make(map[uint32]*ConnInfo)}
+}
+
+// Snapshot is a consistent copy of Stats.
+type Snapshot struct {
+	State       string
+	ConnectTime time.Duration // TCP handshake time of the latest attach
+	RTT         time.Duration // latest PING round trip to the server, zero until measured
+	Active      int
+	Streams     uint64 // streams carried so far
+	BytesIn     uint64
+	BytesOut    uint64
+	Recent      []ConnInfo // open connections first, then the latest closed ones
+}
+
+func (s *Stats) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := Snapshot{
+		State:       s.state,
+		ConnectTime: s.connect,
+		RTT:         s.rtt,
+		Active:      len(s.active),
+		Streams:     s.streams,
+		BytesIn:     s.bytesIn.Load(),
+		BytesOut:    s.bytesOut.Load(),
+	}
+	for _, c := range s.active {
+		snap.Recent = append(snap.Recent, *c)
+	}
+	sort.Slice(snap.Recent, func(i, j int) bool {
+		return snap.Recent[i].Opened.Before(snap.Recent[j].Opened)
+	})
+	for i := len(s.recent) - 1; i >= 0 && len(snap.Recent) < maxRecentConns; i-- {
+		snap.Recent = append(snap.Recent, s.recent[i])
+	}
+	return snap
+}
+
+// The methods below accept a nil receiver so the connector can call them
+// whether or not stats are collected.
+
+func (s *Stats) setState(state string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+}
+
+func (s *Stats) setConnectTime(d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.connect = d
+	s.mu.Unlock()
+}
+
+func (s *Stats) setRTT(rtt time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.rtt = rtt
+	s.mu.Unlock()
+}
+
+func (s *Stats) streamOpened(id uint32, remote string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.active[id] = &ConnInfo{Stream: id, Remote: remote, Opened: time.Now()}
+	s.streams++
+	s.mu.Unlock()
+}
+
+func (s *Stats) streamClosed(id uint32) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.active[id]
+	if !ok {
+		return
+	}
+	delete(s.active, id)
+	c.Closed = time.Now()
+	s.recent = append(s.recent, *c)
+	if over := len(s.recent) - maxRecentConns; over > 0 {
+		s.recent = append([]ConnInfo(nil), s.recent[over:]...)
+	}
+}
+
+func (s *Stats) addIn(id uint32, n int) {
+	if s == nil {
+		return
+	}
+	s.bytesIn.Add(uint64(n))
+	s.mu.Lock()
+	if c, ok := s.active[id]; ok {
+		c.BytesIn += uint64(n)
+	}
+	s.mu.Unlock()
+}
+
+func (s *Stats) addOut(id uint32, n int) {
+	if s == nil {
+		return
+	}
+	s.bytesOut.Add(uint64(n))
+	s.mu.Lock()
+	if c, ok := s.active[id]; ok {
+		c.BytesOut += uint64(n)
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,112 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var ErrNotRunning = errors.New("daemon is not running, start it with: selfgrok daemon")
+
+// Client talks to a running daemon over its control socket.
+type Client struct {
+	http *http.Client
+}
+
+func NewClient() *Client {
+	return &Client{
+		http: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					path, err := SocketPath()
+					if err != nil {
+						return nil, err
+					}
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}
+}
+
+// Running reports whether a daemon answers on the control socket.
+func (c *Client) Running() bool {
+	path, err := SocketPath()
+	if err != nil {
+		return false
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func (c *Client) List() ([]TunnelInfo, error) {
+	var list []TunnelInfo
+	err := c.do(http.MethodGet, "/tunnels", nil, &list)
+	return list, err
+}
+
+func (c *Client) Start(name string) (TunnelInfo, error) {
+	var info TunnelInfo
+	err := c.do(http.MethodPost, "/tunnels", startRequest{Name: name}, &info)
+	return info, err
+}
+
+// Stop stops a tunnel by ID or name.
+func (c *Client) Stop(id string) (TunnelInfo, error) {
+	var info TunnelInfo
+	err := c.do(http.MethodDelete, "/tunnels/"+url.PathEscape(id), nil, &info)
+	return info, err
+}
+
+// Logs returns the tunnel's log lines numbered from since onwards.
+func (c *Client) Logs(id string, since int) (LogsResponse, error) {
+	var res LogsResponse
+	err := c.do(http.MethodGet, fmt.Sprintf("/tunnels/%s/logs?since=%d", url.PathEscape(id), since), nil, &res)
+	return res, err
+}
+
+func (c *Client) do(method, path string, body, out any) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, "http://daemon"+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return ErrNotRunning
+		}
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		var e errorResponse
+		if json.NewDecoder(res.Body).Decode(&e) == nil && e.Error != "" {
+			return errors.New(e.Error)
+		}
+		return fmt.Errorf("daemon returned %s", res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package daemon
+
+import "errors"
+
+// Detach is not supported on Windows; run the daemon as a service instead.
+func Detach(args []string, logPath string) (int, error) {
+	return 0, errors.New("--detach is not supported on Windows")
+}
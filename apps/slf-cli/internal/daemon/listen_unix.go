@@ -0,0 +1,17 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenSocket creates the control socket readable by the owner only. The
+// umask is set while the socket is created, so it never exists with wider
+// permissions; other files created meanwhile only end up stricter.
+func listenSocket(path string) (net.Listener, error) {
+	old := syscall.Umask(0o077)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package daemon
+
+import "net"
+
+// listenSocket creates the control socket. Windows ignores file modes on
+// sockets; access follows the ACL of the config directory.
+func listenSocket(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
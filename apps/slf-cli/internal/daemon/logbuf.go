@@ -0,0 +1,54 @@
+package daemon
+
+import (
+	"bytes"
+	"sync"
+)
+
+const maxLogLines = 1000
+
+// logBuffer keeps the latest log lines of one tunnel. Lines are numbered
+// from the start so followers can ask for what they have not seen yet.
+type logBuffer struct {
+	mu      sync.Mutex
+	lines   []string
+	dropped int
+	partial []byte
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.partial = append(b.partial, p...)
+	for {
+		i := bytes.IndexByte(b.partial, '\n')
+		if i < 0 {
+			break
+		}
+		b.lines = append(b.lines, string(b.partial[:i]))
+		b.partial = b.partial[i+1:]
+	}
+	if over := len(b.lines) - maxLogLines; over > 0 {
+		b.lines = append([]string(nil), b.lines[over:]...)
+		b.dropped += over
+	}
+	return len(p), nil
+}
+
+// Since returns the lines numbered from since onwards and the number to
+// ask for next time.
+func (b *logBuffer) Since(since int) ([]string, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	next := b.dropped + len(b.lines)
+	start := since - b.dropped
+	if start < 0 {
+		start = 0
+	}
+	if start >= len(b.lines) {
+		return nil, next
+	}
+	return append([]string(nil), b.lines[start:]...), next
+}
@@ -0,0 +1,314 @@
+package daemon
+
+import (
+	"cli/internal/api"
+	"cli/internal/config"
+	"cli/internal/session"
+	"cli/internal/tunnel"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	StatusRunning = "running"
+	StatusStopped = "stopped"
+	StatusFailed  = "failed"
+)
+
+// SocketPath is where the daemon serves its control API.
+func SocketPath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "daemon.sock"), nil
+}
+
+// TunnelInfo describes a tunnel run by the daemon.
+type TunnelInfo struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Address   string    `json:"address"`
+	Port      int       `json:"port"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// stopTimeout bounds how long stopping waits for a tunnel to wind down.
+const stopTimeout = 15 * time.Second
+
+type entry struct {
+	info   TunnelInfo
+	tunnel *session.Tunnel
+	logs   *logBuffer
+	done   chan struct{} // closed when the tunnel's Run has returned
+}
+
+// stop closes the tunnel and waits up to stopTimeout for its Run to
+// return, reporting whether it did.
+func (e *entry) stop() bool {
+	e.tunnel.Close()
+	select {
+	case <-e.done:
+		return true
+	case <-time.After(stopTimeout):
+		return false
+	}
+}
+
+// Server runs tunnels in the background and serves the control API on a
+// Unix socket.
+type Server struct {
+	client  *api.Client
+	mu      sync.Mutex
+	tunnels map[string]*entry
+	srv     *http.Server
+}
+
+func NewServer(client *api.Client) *Server {
+	s := &Server{
+		client:  client,
+		tunnels: make(map[string]*entry),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tunnels", s.handleList)
+	mux.HandleFunc("POST /tunnels", s.handleStart)
+	mux.HandleFunc("DELETE /tunnels/{id}", s.handleStop)
+	mux.HandleFunc("GET /tunnels/{id}/logs", s.handleLogs)
+	s.srv = &http.Server{Handler: mux}
+	return s
+}
+
+// Serve listens on the control socket until Shutdown is called.
+func (s *Server) Serve() error {
+	path, err := SocketPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return errors.New("daemon is already running")
+	}
+	_ = os.Remove(path)
+
+	ln, err := listenSocket(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	log.Printf("[daemon] listening on %s", path)
+	if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops the control API and every tunnel, waiting for them to
+// wind down.
+func (s *Server) Shutdown() {
+	s.srv.Close()
+
+	s.mu.Lock()
+	var running []*entry
+	for _, e := range s.tunnels {
+		if e.info.Status == StatusRunning {
+			e.info.Status = StatusStopped
+			running = append(running, e)
+		}
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, e := range running {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !e.stop() {
+				log.Printf("[daemon] tunnel %s (%s) did not stop within %s", e.info.Name, e.info.ID, stopTimeout)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Start brings up the named tunnel from the config file.
+func (s *Server) Start(name string) (TunnelInfo, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return TunnelInfo{}, err
+	}
+	t, ok := cfg.Tunnels[name]
+	if !ok {
+		return TunnelInfo{}, fmt.Errorf("tunnel %q is not defined in the config file", name)
+	}
+	return s.StartTunnel(name, t)
+}
+
+// StartTunnel brings up t under name.
+func (s *Server) StartTunnel(name string, t config.Tunnel) (TunnelInfo, error) {
+	opts, err := tunnel.Options(t)
+	if err != nil {
+		return TunnelInfo{}, err
+	}
+
+	logs := &logBuffer{}
+	opts.Log = log.New(logs, "", log.LstdFlags)
+
+	tun, err := session.Open(s.client, opts)
+	if err != nil {
+		return TunnelInfo{}, err
+	}
+	conn := tun.Connection()
+
+	e := &entry{
+		info: TunnelInfo{
+			ID:        conn.ID,
+			Name:      name,
+			Address:   conn.Address,
+			Port:      conn.ExternalPort,
+			Status:    StatusRunning,
+			StartedAt: time.Now(),
+		},
+		tunnel: tun,
+		logs:   logs,
+		done:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.tunnels[conn.ID] = e
+	s.mu.Unlock()
+
+	go func() {
+		defer close(e.done)
+		err := tun.Run()
+		tun.Close()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if e.info.Status != StatusRunning {
+			return
+		}
+		e.info.Status = StatusStopped
+		if err != nil {
+			e.info.Status = StatusFailed
+			e.info.Error = err.Error()
+		}
+	}()
+
+	log.Printf("[daemon] started tunnel %s (%s)", name, conn.ID)
+	return e.info, nil
+}
+
+// lookup finds a tunnel by ID or name. Callers hold s.mu.
+func (s *Server) lookup(key string) *entry {
+	if e, ok := s.tunnels[key]; ok {
+		return e
+	}
+	var found *entry
+	for _, e := range s.tunnels {
+		if e.info.Name == key && (found == nil || e.info.StartedAt.After(found.info.StartedAt)) {
+			found = e
+		}
+	}
+	return found
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	list := make([]TunnelInfo, 0, len(s.tunnels))
+	for _, e := range s.tunnels {
+		list = append(list, e.info)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.Before(list[j].StartedAt) })
+	writeJSON(w, http.StatusOK, list)
+}
+
+type startRequest struct {
+	Name string `json:"name"`
+}
+
+func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
+	var req startRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeError(w, http.StatusBadRequest, errors.New("expected {\"name\": \"<tunnel>\"}"))
+		return
+	}
+
+	info, err := s.Start(req.Name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, info)
+}
+
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	e := s.lookup(r.PathValue("id"))
+	if e == nil {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, errors.New("tunnel not found"))
+		return
+	}
+	e.info.Status = StatusStopped
+	info := e.info
+	s.mu.Unlock()
+
+	if !e.stop() {
+		log.Printf("[daemon] tunnel %s (%s) did not stop within %s", info.Name, info.ID, stopTimeout)
+		writeError(w, http.StatusGatewayTimeout, fmt.Errorf("tunnel %s is still shutting down", info.Name))
+		return
+	}
+	log.Printf("[daemon] stopped tunnel %s (%s)", info.Name, info.ID)
+	writeJSON(w, http.StatusOK, info)
+}
+
+// LogsResponse carries log lines and the offset to continue from.
+type LogsResponse struct {
+	Lines []string `json:"lines"`
+	Next  int      `json:"next"`
+}
+
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	e := s.lookup(r.PathValue("id"))
+	s.mu.Unlock()
+	if e == nil {
+		writeError(w, http.StatusNotFound, errors.New("tunnel not found"))
+		return
+	}
+
+	since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+	lines, next := e.logs.Since(since)
+	writeJSON(w, http.StatusOK, LogsResponse{Lines: lines, Next: next})
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
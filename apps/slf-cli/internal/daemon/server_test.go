@@ -0,0 +1,208 @@
+package daemon_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cli/internal/api"
+	"cli/internal/config"
+	"cli/internal/daemon"
+)
+
+// fakeBackend stands in for the backend API and slf-server's internal
+// port: it hands out sessions on its own listener and records deletions.
+type fakeBackend struct {
+	api      *httptest.Server
+	internal net.Listener
+
+	mu       sync.Mutex
+	created  int
+	attached map[string]bool // by remote address, false once closed
+	deleted  map[string]bool
+}
+
+func newFakeBackend(t *testing.T) *fakeBackend {
+	t.Helper()
+	b := &fakeBackend{attached: make(map[string]bool), deleted: make(map[string]bool)}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.internal = ln
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.attached[c.RemoteAddr().String()] = true
+			b.mu.Unlock()
+			go func() {
+				_, _ = io.Copy(io.Discard, c)
+				c.Close()
+				b.mu.Lock()
+				b.attached[c.RemoteAddr().String()] = false
+				b.mu.Unlock()
+			}()
+		}
+	}()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	b.api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/connection/")
+		conn := api.Connection{ID: id, Address: "127.0.0.1", ExternalPort: 1, InternalPort: port, Status: "connected", AgentSecret: "secret"}
+		switch r.Method {
+		case http.MethodPost:
+			b.mu.Lock()
+			b.created++
+			conn.ID = "conn-" + strconv.Itoa(b.created)
+			b.mu.Unlock()
+			json.NewEncoder(w).Encode(api.ConnectionResponse{Success: true, Data: &conn})
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(api.ConnectionResponse{Success: true, Data: &conn})
+		case http.MethodPatch:
+			json.NewEncoder(w).Encode(api.GenericResponse{Success: true, Data: true})
+		case http.MethodDelete:
+			b.mu.Lock()
+			b.deleted[id] = true
+			b.mu.Unlock()
+			json.NewEncoder(w).Encode(api.GenericResponse{Success: true})
+		}
+	}))
+	t.Cleanup(func() {
+		b.api.Close()
+		ln.Close()
+	})
+	return b
+}
+
+func (b *fakeBackend) wasDeleted(id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.deleted[id]
+}
+
+func (b *fakeBackend) attachedCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, open := range b.attached {
+		if open {
+			n++
+		}
+	}
+	return n
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDaemonLifecycle(t *testing.T) {
+	// unix socket paths are short, so keep the state out of t.TempDir()
+	dir, err := os.MkdirTemp("", "sgd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config.SetStateDir(dir)
+	defer config.SetStateDir("")
+
+	backend := newFakeBackend(t)
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	tunnel := config.Tunnel{Host: "127.0.0.1", Port: strconv.Itoa(target.Addr().(*net.TCPAddr).Port)}
+
+	srv := daemon.NewServer(api.NewWith(backend.api.URL, "token"))
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve() }()
+	client := daemon.NewClient()
+	waitFor(t, "the control socket", client.Running)
+
+	ids := make(map[string]string)
+	for _, name := range []string{"web", "api", "db"} {
+		info, err := srv.StartTunnel(name, tunnel)
+		if err != nil {
+			t.Fatalf("start %s: %v", name, err)
+		}
+		ids[name] = info.ID
+	}
+	waitFor(t, "three attached tunnels", func() bool { return backend.attachedCount() == 3 })
+
+	tests := []struct {
+		key    string // ID or name passed to Stop
+		name   string // tunnel that must be stopped, empty when Stop must fail
+		remain int    // tunnels still attached afterwards
+	}{
+		{key: "web", name: "web", remain: 2},
+		{key: ids["api"], name: "api", remain: 1},
+		{key: "missing", remain: 1},
+	}
+	for _, tt := range tests {
+		info, err := client.Stop(tt.key)
+		if tt.name == "" {
+			if err == nil {
+				t.Errorf("Stop(%q) succeeded, want an error", tt.key)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Stop(%q): %v", tt.key, err)
+		}
+		if info.Name != tt.name || info.Status != daemon.StatusStopped {
+			t.Errorf("Stop(%q) = %s %s, want %s stopped", tt.key, info.Name, info.Status, tt.name)
+		}
+		// Stop answers once the tunnel has wound down and deleted its session
+		if !backend.wasDeleted(ids[tt.name]) {
+			t.Errorf("Stop(%q) returned before the session was deleted", tt.key)
+		}
+		waitFor(t, fmt.Sprintf("%d attached tunnels", tt.remain), func() bool { return backend.attachedCount() == tt.remain })
+	}
+
+	list, err := client.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := make(map[string]string)
+	for _, info := range list {
+		status[info.Name] = info.Status
+	}
+	want := map[string]string{"web": daemon.StatusStopped, "api": daemon.StatusStopped, "db": daemon.StatusRunning}
+	for name, s := range want {
+		if status[name] != s {
+			t.Errorf("%s is %q, want %q", name, status[name], s)
+		}
+	}
+
+	srv.Shutdown()
+	if !backend.wasDeleted(ids["db"]) {
+		t.Error("Shutdown returned before the remaining tunnel was deleted")
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+	if client.Running() {
+		t.Error("control socket still answers after Shutdown")
+	}
+}
@@ -0,0 +1,190 @@
+package dashboard
+
+import (
+	"bytes"
+	"cli/internal/connector"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	refreshInterval = time.Second
+	maxLogLines     = 5
+)
+
+// Tunnel is one tunnel shown on the dashboard.
+type Tunnel struct {
+	Name       string
+	Address    string // public host:port, empty for private sessions
+	ShareToken string
+	Stats      *connector.Stats
+}
+
+// Dashboard redraws a live status view of its tunnels in place. It is also
+// an io.Writer that keeps the latest log lines, so tunnel logs show up in
+// the view instead of scrolling it away.
+type Dashboard struct {
+	out      io.Writer
+	mu       sync.Mutex
+	tunnels  []Tunnel
+	logs     []string
+	partial  []byte
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func New(out io.Writer) *Dashboard {
+	return &Dashboard{
+		out:  out,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// IsTerminal reports whether f is attached to a terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func (d *Dashboard) Add(t Tunnel) {
+	d.mu.Lock()
+	d.tunnels = append(d.tunnels, t)
+	d.mu.Unlock()
+}
+
+func (d *Dashboard) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.partial = append(d.partial, p...)
+	for {
+		i := bytes.IndexByte(d.partial, '\n')
+		if i < 0 {
+			break
+		}
+		d.logs = append(d.logs, string(d.partial[:i]))
+		d.partial = d.partial[i+1:]
+	}
+	if over := len(d.logs) - maxLogLines; over > 0 {
+		d.logs = append([]string(nil), d.logs[over:]...)
+	}
+	return len(p), nil
+}
+
+// Start hides the cursor and redraws the view until Stop is called.
+func (d *Dashboard) Start() {
+	fmt.Fprint(d.out, "\x1b[?25l")
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			d.draw()
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop draws the view a last time, leaving it on screen, and restores the
+// cursor.
+func (d *Dashboard) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+		<-d.done
+		d.draw()
+		fmt.Fprint(d.out, "\x1b[?25h")
+	})
+}
+
+func (d *Dashboard) draw() {
+	d.mu.Lock()
+	tunnels := append([]Tunnel(nil), d.tunnels...)
+	logs := append([]string(nil), d.logs...)
+	d.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	b.WriteString("SelfGrok                                   (Ctrl+C to quit)\n")
+
+	for _, t := range tunnels {
+		snap := t.Stats.Snapshot()
+		b.WriteString("\n")
+		if t.Name != "" {
+			row(&b, "Tunnel", t.Name)
+		}
+		if t.Address != "" {
+			row(&b, "Address", t.Address)
+		} else {
+			row(&b, "Address", "private, share token "+t.ShareToken)
+		}
+		row(&b, "Status", snap.State)
+		row(&b, "RTT", formatDuration(snap.RTT))
+		row(&b, "Connect", formatDuration(snap.ConnectTime))
+		row(&b, "Streams", fmt.Sprintf("%d active, %d total", snap.Active, snap.Streams))
+		row(&b, "Traffic", fmt.Sprintf("in %s  out %s", formatBytes(snap.BytesIn), formatBytes(snap.BytesOut)))
+
+		if len(snap.Recent) > 0 {
+			b.WriteString("\nRecent connections\n")
+			for _, c := range snap.Recent {
+				state := "closed"
+				if c.Closed.IsZero() {
+					state = "open"
+				}
+				remote := c.Remote
+				if remote == "" {
+					remote = "-"
+				}
+				fmt.Fprintf(&b, "  %-24s %-7s %8s  in %-10s out %s\n",
+					remote, state, c.Duration().Round(time.Second), formatBytes(c.BytesIn), formatBytes(c.BytesOut))
+			}
+		}
+	}
+
+	if len(logs) > 0 {
+		b.WriteString("\nLog\n")
+		for _, line := range logs {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+
+	io.WriteString(d.out, b.String())
+}
+
+func row(b *strings.Builder, label, value string) {
+	fmt.Fprintf(b, "%-12s %s\n", label, value)
+}
+
+// formatDuration shows a measured duration, or "-" before the first
+// measurement.
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(100 * time.Microsecond).String()
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
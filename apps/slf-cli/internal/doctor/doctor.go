@@ -0,0 +1,267 @@
+package doctor
+
+import (
+	"cli/internal/api"
+	"cli/internal/config"
+	"cli/internal/connector"
+	"cli/internal/session"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Check results.
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+const (
+	loopbackBytes   = 1 << 20
+	loopbackTimeout = 15 * time.Second
+	attachTimeout   = 15 * time.Second
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// Options selects the optional local target check.
+type Options struct {
+	Target *session.Options // nil to skip the local target check
+}
+
+// Report runs the checks in order. Checks that depend on a failed one are
+// skipped.
+func Report(opts Options) []Result {
+	var results []Result
+	add := func(name, status, detail string) {
+		results = append(results, Result{Name: name, Status: status, Detail: detail})
+	}
+	skipRest := func(names ...string) {
+		for _, name := range names {
+			add(name, StatusSkip, "skipped after an earlier failure")
+		}
+	}
+
+	cfg, err := config.Load()
+	profile := config.ProfileName()
+	if profile == "" {
+		profile = "default"
+	}
+	switch {
+	case err != nil:
+		add("Config", StatusFail, err.Error())
+	case cfg.Token == "":
+		add("Config", StatusFail, "no token for profile "+profile+", run selfgrok login")
+	case cfg.ServerURL == "":
+		add("Config", StatusFail, "no server URL for profile "+profile)
+	default:
+		if u, perr := url.Parse(cfg.ServerURL); perr != nil || u.Host == "" {
+			add("Config", StatusFail, fmt.Sprintf("server URL %q is not a valid URL", cfg.ServerURL))
+		} else {
+			path, _ := config.Path() // Load succeeded, so did Path
+			add("Config", StatusOK, fmt.Sprintf("profile %s, %s", profile, path))
+		}
+	}
+	if results[0].Status == StatusFail {
+		skipRest("API", "Auth", "Session", "Internal port", "Loopback")
+		return append(results, checkTarget(opts))
+	}
+
+	if proxy := proxyFor(cfg.ServerURL); proxy != "" {
+		add("Proxy", StatusWarn, "API requests go through "+proxy+", tunnel traffic does not")
+	}
+
+	start := time.Now()
+	res, err := (&http.Client{Timeout: 10 * time.Second}).Get(cfg.ServerURL)
+	if err != nil {
+		add("API", StatusFail, err.Error())
+		skipRest("Auth", "Session", "Internal port", "Loopback")
+		return append(results, checkTarget(opts))
+	}
+	res.Body.Close()
+	add("API", StatusOK, fmt.Sprintf("%s reachable in %s", cfg.ServerURL, since(start)))
+
+	client := api.NewWith(cfg.ServerURL, cfg.Token)
+	me, err := client.Me()
+	if err != nil {
+		detail := err.Error()
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.Unauthorized() {
+			detail = fmt.Sprintf("token %s rejected: %v", config.MaskToken(cfg.Token), err)
+		}
+		add("Auth", StatusFail, detail)
+		skipRest("Session", "Internal port", "Loopback")
+		return append(results, checkTarget(opts))
+	}
+	add("Auth", StatusOK, fmt.Sprintf("token %s, expires %s", config.MaskToken(cfg.Token), me.ExpiresAt.Format(time.DateOnly)))
+
+	results = append(results, checkSession(client)...)
+	return append(results, checkTarget(opts))
+}
+
+// checkSession creates a throwaway session, attaches to its internal port
+// and sends data through its public port back to an in-process echo
+// service, so the whole path CLI → server → CLI is exercised.
+func checkSession(client *api.Client) []Result {
+	conn, err := client.CreateConnection(&api.ConnectionOptions{Protocol: "tcp"})
+	if err != nil {
+		return []Result{
+			{"Session", StatusFail, err.Error()},
+			{"Internal port", StatusSkip, "skipped after an earlier failure"},
+			{"Loopback", StatusSkip, "skipped after an earlier failure"},
+		}
+	}
+	defer client.DeleteConnection(conn.ID)
+
+	externalAddr := net.JoinHostPort(conn.Address, strconv.Itoa(conn.ExternalPort))
+	internalAddr := net.JoinHostPort(conn.Address, strconv.Itoa(conn.InternalPort))
+	results := []Result{{"Session", StatusOK, fmt.Sprintf("created %s on %s", conn.ID, externalAddr)}}
+
+	stats := connector.NewStats()
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- connector.ConnectAndRun(connector.Options{
+			LocalTarget: "doctor echo",
+			Dial:        echoDial,
+			Log:         log.New(io.Discard, "", 0),
+			Stats:       stats,
+			Reconnect:   connector.ReconnectPolicy{MaxAttempts: 1},
+			Stop:        stop,
+		}, client, conn)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	deadline := time.Now().Add(attachTimeout)
+	for stats.Snapshot().State != connector.StateConnected {
+		select {
+		case err := <-done:
+			done <- err
+			return append(results,
+				Result{"Internal port", StatusFail, fmt.Sprintf("%s: %v", internalAddr, err)},
+				Result{"Loopback", StatusSkip, "skipped after an earlier failure"})
+		default:
+		}
+		if time.Now().After(deadline) {
+			return append(results,
+				Result{"Internal port", StatusFail, internalAddr + ": no handshake within " + attachTimeout.String()},
+				Result{"Loopback", StatusSkip, "skipped after an earlier failure"})
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	results = append(results, Result{"Internal port", StatusOK,
+		fmt.Sprintf("%s attached, handshake %s", internalAddr, stats.Snapshot().ConnectTime.Round(100*time.Microsecond))})
+
+	rtt, throughput, err := loopback(externalAddr)
+	if err != nil {
+		return append(results, Result{"Loopback", StatusFail, fmt.Sprintf("%s: %v (the public port may not be reachable from this host)", externalAddr, err)})
+	}
+	return append(results, Result{"Loopback", StatusOK,
+		fmt.Sprintf("RTT %s, throughput %s/s", rtt.Round(100*time.Microsecond), formatBytes(throughput))})
+}
+
+// loopback measures the round trip of one byte and the throughput of
+// echoing loopbackBytes through addr.
+func loopback(addr string) (time.Duration, float64, error) {
+	c, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer c.Close()
+	_ = c.SetDeadline(time.Now().Add(loopbackTimeout))
+
+	buf := make([]byte, 32*1024)
+	start := time.Now()
+	if _, err := c.Write([]byte{'p'}); err != nil {
+		return 0, 0, err
+	}
+	if _, err := io.ReadFull(c, buf[:1]); err != nil {
+		return 0, 0, err
+	}
+	rtt := time.Since(start)
+
+	start = time.Now()
+	writeErr := make(chan error, 1)
+	go func() {
+		chunk := make([]byte, 32*1024)
+		var err error
+		for sent := 0; sent < loopbackBytes && err == nil; sent += len(chunk) {
+			_, err = c.Write(chunk)
+		}
+		writeErr <- err
+	}()
+	if _, err := io.ReadFull(c, make([]byte, loopbackBytes)); err != nil {
+		return rtt, 0, err
+	}
+	if err := <-writeErr; err != nil {
+		return rtt, 0, err
+	}
+	return rtt, float64(loopbackBytes) / time.Since(start).Seconds(), nil
+}
+
+// echoDial serves a stream in-process by sending back what it receives.
+func echoDial() (net.Conn, error) {
+	local, remote := net.Pipe()
+	go func() {
+		_, _ = io.Copy(remote, remote)
+		remote.Close()
+	}()
+	return local, nil
+}
+
+func checkTarget(opts Options) Result {
+	if opts.Target == nil {
+		return Result{"Local target", StatusSkip, "pass --port or --target to check it"}
+	}
+	if err := session.CheckTarget(*opts.Target); err != nil {
+		return Result{"Local target", StatusFail, err.Error()}
+	}
+	addr := opts.Target.Target
+	if addr == "" {
+		addr = net.JoinHostPort(opts.Target.Host, opts.Target.Port)
+	}
+	return Result{"Local target", StatusOK, addr + " accepts connections"}
+}
+
+// proxyFor returns the proxy used for requests to serverURL, if any.
+func proxyFor(serverURL string) string {
+	req, err := http.NewRequest(http.MethodGet, serverURL, nil)
+	if err != nil {
+		return ""
+	}
+	proxy, err := http.ProxyFromEnvironment(req)
+	if err != nil || proxy == nil {
+		return ""
+	}
+	return proxy.Redacted()
+}
+
+func since(start time.Time) time.Duration {
+	return time.Since(start).Round(100 * time.Microsecond)
+}
+
+func formatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
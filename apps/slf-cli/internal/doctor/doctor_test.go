@@ -0,0 +1,158 @@
+package doctor_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"cli/internal/api"
+	"cli/internal/config"
+	"cli/internal/doctor"
+	"cli/internal/session"
+
+	"github.com/zalando/go-keyring"
+)
+
+// closedPort returns a local port nothing listens on.
+func closedPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+// fakeAPI answers like the backend. A session's internal port is closed,
+// so attaching to it fails.
+func fakeAPI(t *testing.T, meStatus, createStatus int) string {
+	t.Helper()
+	internal := closedPort(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/me":
+			w.WriteHeader(meStatus)
+			if meStatus != http.StatusOK {
+				json.NewEncoder(w).Encode(api.MeResponse{Message: "invalid api key"})
+				return
+			}
+			json.NewEncoder(w).Encode(api.MeResponse{Success: true, Data: &api.Me{ExpiresAt: time.Now().Add(time.Hour)}})
+		case r.Method == http.MethodPost && r.URL.Path == "/api/connection":
+			w.WriteHeader(createStatus)
+			if createStatus != http.StatusOK {
+				json.NewEncoder(w).Encode(api.ConnectionResponse{Message: "no ports available"})
+				return
+			}
+			json.NewEncoder(w).Encode(api.ConnectionResponse{Success: true, Data: &api.Connection{
+				ID: "doctor", Address: "127.0.0.1", ExternalPort: closedPort(t), InternalPort: internal, Status: "connecting", AgentSecret: "secret",
+			}})
+		case strings.HasPrefix(r.URL.Path, "/api/connection/"):
+			json.NewEncoder(w).Encode(api.GenericResponse{Success: true, Data: true})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestReport(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	open := &session.Options{Host: "127.0.0.1", Port: strconv.Itoa(target.Addr().(*net.TCPAddr).Port)}
+	closed := &session.Options{Host: "127.0.0.1", Port: strconv.Itoa(closedPort(t))}
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name   string
+		token  string
+		url    string
+		target *session.Options
+		want   map[string]string // status by check name
+		detail string            // found in the failed check's detail
+	}{
+		{
+			name: "no token",
+			url:  "http://127.0.0.1:1",
+			want: map[string]string{"Config": doctor.StatusFail, "API": doctor.StatusSkip, "Loopback": doctor.StatusSkip, "Local target": doctor.StatusSkip},
+		},
+		{
+			name:  "invalid server URL",
+			token: "sg_token",
+			url:   "not a url",
+			want:  map[string]string{"Config": doctor.StatusFail, "Auth": doctor.StatusSkip},
+		},
+		{
+			name:  "API unreachable",
+			token: "sg_token",
+			url:   unreachable.URL,
+			want:  map[string]string{"Config": doctor.StatusOK, "API": doctor.StatusFail, "Auth": doctor.StatusSkip, "Session": doctor.StatusSkip},
+		},
+		{
+			name:   "token rejected",
+			token:  "sg_token",
+			url:    fakeAPI(t, http.StatusUnauthorized, http.StatusOK),
+			want:   map[string]string{"API": doctor.StatusOK, "Auth": doctor.StatusFail, "Session": doctor.StatusSkip},
+			detail: "rejected",
+		},
+		{
+			name:   "session refused",
+			token:  "sg_token",
+			url:    fakeAPI(t, http.StatusOK, http.StatusServiceUnavailable),
+			want:   map[string]string{"Auth": doctor.StatusOK, "Session": doctor.StatusFail, "Internal port": doctor.StatusSkip, "Loopback": doctor.StatusSkip},
+			detail: "no ports available",
+		},
+		{
+			name:  "internal port closed",
+			token: "sg_token",
+			url:   fakeAPI(t, http.StatusOK, http.StatusOK),
+			want:  map[string]string{"Session": doctor.StatusOK, "Internal port": doctor.StatusFail, "Loopback": doctor.StatusSkip},
+		},
+		{
+			name:   "local target up",
+			url:    "http://127.0.0.1:1",
+			target: open,
+			want:   map[string]string{"Config": doctor.StatusFail, "Local target": doctor.StatusOK},
+		},
+		{
+			name:   "local target down",
+			url:    "http://127.0.0.1:1",
+			target: closed,
+			want:   map[string]string{"Config": doctor.StatusFail, "Local target": doctor.StatusFail},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv(config.EnvStateDir, "")
+			t.Setenv(config.EnvProfile, "")
+			t.Setenv(config.EnvToken, tt.token)
+			t.Setenv(config.EnvServerURL, tt.url)
+			keyring.MockInit()
+
+			results := doctor.Report(doctor.Options{Target: tt.target})
+			got := make(map[string]doctor.Result)
+			for _, r := range results {
+				got[r.Name] = r
+			}
+			for name, status := range tt.want {
+				if got[name].Status != status {
+					t.Errorf("%s is %q (%s), want %q", name, got[name].Status, got[name].Detail, status)
+				}
+				if status == doctor.StatusFail && tt.detail != "" && !strings.Contains(got[name].Detail, tt.detail) {
+					t.Errorf("%s detail %q does not mention %q", name, got[name].Detail, tt.detail)
+				}
+			}
+		})
+	}
+}
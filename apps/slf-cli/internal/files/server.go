@@ -0,0 +1,138 @@
+package files
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Server serves a directory over HTTP inside the CLI. Connections come
+// from the connector through Dial, so no local port is opened.
+type Server struct {
+	ln  *pipeListener
+	srv *http.Server
+}
+
+type Options struct {
+	Dir      string
+	User     string // require basic auth when set
+	Password string
+	Hidden   bool        // also serve names starting with a dot
+	Log      *log.Logger // request log lines, the standard logger when nil
+}
+
+func (o Options) logger() *log.Logger {
+	if o.Log != nil {
+		return o.Log
+	}
+	return log.Default()
+}
+
+// NewServer serves opts.Dir with directory listings and range requests.
+// Files and directories whose name starts with a dot are neither listed
+// nor served unless Hidden is set. When User is set every request must
+// carry matching basic auth credentials.
+func NewServer(opts Options) (*Server, error) {
+	info, err := os.Stat(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", opts.Dir)
+	}
+
+	var root http.FileSystem = http.Dir(opts.Dir)
+	if !opts.Hidden {
+		root = noDotFiles{root}
+	}
+	var handler http.Handler = http.FileServer(root)
+	if opts.User != "" {
+		handler = basicAuth(handler, opts.User, opts.Password)
+	}
+
+	logger := opts.logger()
+	s := &Server{
+		ln: newPipeListener(),
+		srv: &http.Server{
+			Handler:           logRequests(handler, logger),
+			ReadHeaderTimeout: 30 * time.Second,
+			ErrorLog:          logger,
+		},
+	}
+	go func() {
+		if err := s.srv.Serve(s.ln); err != nil && err != http.ErrServerClosed {
+			logger.Printf("[files] serve error: %v", err)
+		}
+	}()
+	return s, nil
+}
+
+// Dial opens a connection to the file server.
+func (s *Server) Dial() (net.Conn, error) {
+	return s.ln.dial()
+}
+
+func (s *Server) Close() error {
+	return s.srv.Close()
+}
+
+// noDotFiles hides files and directories whose name starts with a dot,
+// such as .git or .env, from listings and requests.
+type noDotFiles struct {
+	http.FileSystem
+}
+
+func (fsys noDotFiles) Open(name string) (http.File, error) {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return nil, fs.ErrNotExist
+		}
+	}
+	f, err := fsys.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return noDotFile{f}, nil
+}
+
+type noDotFile struct {
+	http.File
+}
+
+func (f noDotFile) Readdir(n int) ([]fs.FileInfo, error) {
+	infos, err := f.File.Readdir(n)
+	visible := infos[:0]
+	for _, info := range infos {
+		if !strings.HasPrefix(info.Name(), ".") {
+			visible = append(visible, info)
+		}
+	}
+	return visible, err
+}
+
+func basicAuth(next http.Handler, user, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="selfgrok"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func logRequests(next http.Handler, logger *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.Printf("[files] %s %s", r.Method, r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,150 @@
+package files_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cli/internal/files"
+)
+
+// serve shares a directory holding notes.txt, sub/a.txt, .env and
+// .git/config, and returns a client whose requests reach it through Dial.
+func serve(t *testing.T, user, password string, hidden bool) *http.Client {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"notes.txt":   "0123456789",
+		"sub/a.txt":   "a",
+		".env":        "SECRET=1",
+		".git/config": "[core]",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv, err := files.NewServer(files.Options{Dir: dir, User: user, Password: password, Hidden: hidden, Log: log.New(io.Discard, "", 0)})
+	if err != nil {
+		t.Fatalf("failed to serve %s: %v", dir, err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return srv.Dial()
+		},
+	}}
+}
+
+func get(t *testing.T, c *http.Client, path string, header http.Header) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, "http://files"+path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(body)
+}
+
+func TestNewServerRejectsFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(path, nil, 0o644)
+	if _, err := files.NewServer(files.Options{Dir: path}); err == nil {
+		t.Error("expected an error for a file")
+	}
+	if _, err := files.NewServer(files.Options{Dir: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestServerServesFilesAndListings(t *testing.T) {
+	c := serve(t, "", "", false)
+
+	if status, body := get(t, c, "/notes.txt", nil); status != http.StatusOK || body != "0123456789" {
+		t.Errorf("GET /notes.txt = %d %q", status, body)
+	}
+	if status, body := get(t, c, "/", nil); status != http.StatusOK ||
+		!strings.Contains(body, "notes.txt") || !strings.Contains(body, "sub/") {
+		t.Errorf("GET / = %d %q, expected a listing", status, body)
+	}
+
+	status, body := get(t, c, "/notes.txt", http.Header{"Range": {"bytes=2-4"}})
+	if status != http.StatusPartialContent || body != "234" {
+		t.Errorf("range request = %d %q, expected 206 \"234\"", status, body)
+	}
+}
+
+func TestServerHidesDotFiles(t *testing.T) {
+	c := serve(t, "", "", false)
+
+	for _, path := range []string{"/.env", "/.git/config", "/.git/", "/sub/../.env"} {
+		if status, _ := get(t, c, path, nil); status != http.StatusNotFound {
+			t.Errorf("GET %s = %d, expected 404", path, status)
+		}
+	}
+	if _, body := get(t, c, "/", nil); strings.Contains(body, ".env") || strings.Contains(body, ".git") {
+		t.Errorf("listing shows dotfiles: %q", body)
+	}
+
+	c = serve(t, "", "", true)
+	if status, body := get(t, c, "/.env", nil); status != http.StatusOK || body != "SECRET=1" {
+		t.Errorf("GET /.env with hidden = %d %q", status, body)
+	}
+}
+
+func TestServerRequiresBasicAuth(t *testing.T) {
+	c := serve(t, "dev", "secret", false)
+
+	if status, _ := get(t, c, "/notes.txt", nil); status != http.StatusUnauthorized {
+		t.Errorf("without credentials = %d, expected 401", status)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://files/notes.txt", nil)
+	req.SetBasicAuth("dev", "wrong")
+	if status, _ := get(t, c, "/notes.txt", req.Header); status != http.StatusUnauthorized {
+		t.Errorf("wrong password = %d, expected 401", status)
+	}
+	req.SetBasicAuth("dev", "secret")
+	if status, body := get(t, c, "/notes.txt", req.Header); status != http.StatusOK || body != "0123456789" {
+		t.Errorf("valid credentials = %d %q", status, body)
+	}
+}
+
+func TestServerLogsToLogger(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hi"), 0o644)
+	var buf bytes.Buffer
+	srv, err := files.NewServer(files.Options{Dir: dir, Log: log.New(&buf, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	c := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return srv.Dial()
+		},
+	}}
+
+	if status, _ := get(t, c, "/notes.txt", nil); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if !strings.Contains(buf.String(), "[files] GET /notes.txt") {
+		t.Fatalf("request not logged to the logger: %q", buf.String())
+	}
+}
@@ -0,0 +1,146 @@
+package inspect
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cli/internal/config"
+)
+
+const (
+	maxCaptures    = 100
+	maxCaptureBody = 1 << 20
+)
+
+type Capture struct {
+	ID     string      `json:"id"`
+	Time   time.Time   `json:"time"`
+	Target string      `json:"target"`
+	Method string      `json:"method"`
+	URI    string      `json:"uri"`
+	Host   string      `json:"host"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body,omitempty"`
+
+	// Truncated is set when the request body was larger than
+	// maxCaptureBody and only its start was kept.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+func capturesDir() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "captures"), nil
+}
+
+func newID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func Save(c *Capture) error {
+	dir, err := capturesDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, c.ID+".json"), data, 0o600); err != nil {
+		return err
+	}
+
+	prune(dir)
+	return nil
+}
+
+func Load(id string) (*Capture, error) {
+	dir, err := capturesDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("request %s not found", id)
+		}
+		return nil, err
+	}
+
+	var c Capture
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid capture %s: %w", id, err)
+	}
+	return &c, nil
+}
+
+// List returns the stored captures, newest first.
+func List() ([]*Capture, error) {
+	dir, err := capturesDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var all []*Capture
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		c, err := Load(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		all = append(all, c)
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].Time.After(all[j].Time) })
+	return all, nil
+}
+
+func prune(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) <= maxCaptures {
+		return
+	}
+
+	type file struct {
+		name string
+		mod  time.Time
+	}
+	var files []file
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{name: e.Name(), mod: info.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].mod.Before(files[j].mod) })
+	for i := 0; i < len(files)-maxCaptures; i++ {
+		_ = os.Remove(filepath.Join(dir, files[i].name))
+	}
+}
@@ -0,0 +1,129 @@
+package inspect_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"cli/internal/config"
+	"cli/internal/inspect"
+)
+
+// useHome keeps captures in a fresh state directory.
+func useHome(t *testing.T) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(config.EnvStateDir, "")
+}
+
+func TestTapMarksTruncatedBody(t *testing.T) {
+	useHome(t)
+
+	body := bytes.Repeat([]byte("x"), 1<<20+10)
+	tap := inspect.Tap(1, "127.0.0.1:1", log.New(io.Discard, "", 0))
+	fmt.Fprintf(tap, "POST /hook HTTP/1.1\r\nHost: example.com\r\nContent-Length: %d\r\n\r\n", len(body))
+	tap.Write(body)
+	tap.Close()
+
+	var captures []*inspect.Capture
+	for deadline := time.Now().Add(2 * time.Second); len(captures) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("request was not captured")
+		}
+		time.Sleep(10 * time.Millisecond)
+		captures, _ = inspect.List()
+	}
+	c := captures[0]
+	if !c.Truncated || len(c.Body) != 1<<20 {
+		t.Fatalf("capture truncated=%v with %d body bytes, want truncated to 1 MiB", c.Truncated, len(c.Body))
+	}
+	if _, err := inspect.Replay(c, "", false); !errors.Is(err, inspect.ErrTruncated) {
+		t.Fatalf("Replay of a truncated capture: %v, want ErrTruncated", err)
+	}
+}
+
+func TestInspectorReplay(t *testing.T) {
+	useHome(t)
+
+	type received struct {
+		header http.Header
+		body   string
+	}
+	got := make(chan received, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got <- received{header: r.Header, body: string(b)}
+		io.WriteString(w, "pong")
+	}))
+	defer target.Close()
+
+	c := &inspect.Capture{
+		ID:     "abc123",
+		Time:   time.Now(),
+		Target: strings.TrimPrefix(target.URL, "http://"),
+		Method: "POST",
+		URI:    "/hook",
+		Host:   "example.com",
+		Header: http.Header{"X-Old": {"1"}},
+		Body:   []byte("captured"),
+	}
+	if err := inspect.Save(c); err != nil {
+		t.Fatal(err)
+	}
+	h := inspect.Handler(false)
+
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		form   url.Values
+		status int
+		header string // header the target must see, empty when refused
+		body   string
+	}{
+		{name: "as captured", host: "127.0.0.1:4040", status: http.StatusOK, header: "X-Old", body: "captured"},
+		{name: "edited", host: "localhost:4040", form: url.Values{"headers": {"X-New: 2"}, "body": {"edited"}}, status: http.StatusOK, header: "X-New", body: "edited"},
+		{name: "same origin", host: "localhost:4040", origin: "http://localhost:4040", status: http.StatusOK, header: "X-Old", body: "captured"},
+		{name: "cross origin", host: "localhost:4040", origin: "http://evil.example", status: http.StatusForbidden},
+		{name: "rebound host", host: "evil.example:4040", status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/requests/abc123/replay", strings.NewReader(tt.form.Encode()))
+			req.Host = tt.host
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.header == "" {
+				select {
+				case <-got:
+					t.Fatal("refused replay reached the target")
+				default:
+				}
+				return
+			}
+			r := <-got
+			if r.header.Get(tt.header) == "" || r.body != tt.body {
+				t.Fatalf("target got headers %v and body %q, want %s and %q", r.header, r.body, tt.header, tt.body)
+			}
+			if !strings.Contains(rec.Body.String(), "pong") {
+				t.Fatal("page does not show the response")
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package inspect
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tapQueue is how many payloads a tap buffers for its recorder. A stream
+// that outpaces the recorder by more is no longer captured.
+const tapQueue = 64
+
+// Tap returns a writer that receives the inbound bytes of one stream and
+// records every HTTP request found in them. Non-HTTP streams are ignored.
+// Writes never block: they are queued for a recorder goroutine and dropped
+// once the queue is full. The caller must close the writer when the stream
+// ends; Close may be called more than once. Captures are logged to logger.
+func Tap(streamID uint32, target string, logger *log.Logger) io.WriteCloser {
+	t := &tap{
+		streamID: streamID,
+		logger:   logger,
+		queue:    make(chan []byte, tapQueue),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(t.done)
+		record(streamID, target, &queueReader{queue: t.queue}, logger)
+	}()
+	return t
+}
+
+type tap struct {
+	streamID uint32
+	logger   *log.Logger
+	mu       sync.Mutex
+	queue    chan []byte
+	closed   bool
+	done     chan struct{} // closed when the recorder stops reading
+}
+
+func (t *tap) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return len(p), nil
+	}
+	select {
+	case <-t.done:
+		// not HTTP, or the recorder gave up; nobody reads the queue
+		t.closeLocked()
+		return len(p), nil
+	default:
+	}
+
+	select {
+	case t.queue <- append([]byte(nil), p...):
+	default:
+		t.logger.Printf("[inspect] stream %d faster than the recorder, no longer capturing it", t.streamID)
+		t.closeLocked()
+	}
+	return len(p), nil
+}
+
+func (t *tap) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closeLocked()
+	return nil
+}
+
+func (t *tap) closeLocked() {
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+}
+
+// queueReader reads the payloads of a tap's queue as one stream, ending
+// when the queue is closed.
+type queueReader struct {
+	queue <-chan []byte
+	buf   []byte
+}
+
+func (r *queueReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		b, ok := <-r.queue
+		if !ok {
+			return 0, io.EOF
+		}
+		r.buf = b
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func record(streamID uint32, target string, r io.Reader, logger *log.Logger) {
+	br := bufio.NewReader(r)
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+
+		body, _ := io.ReadAll(io.LimitReader(req.Body, maxCaptureBody+1))
+		truncated := len(body) > maxCaptureBody
+		if truncated {
+			body = body[:maxCaptureBody]
+		}
+		_, _ = io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+
+		c := &Capture{
+			ID:     newID(),
+			Time:   time.Now(),
+			Target: target,
+			Method: req.Method,
+			URI:    req.RequestURI,
+			Host:   req.Host,
+			Header: req.Header,
+			Body:   body,
+
+			Truncated: truncated,
+		}
+		if err := Save(c); err != nil {
+			logger.Printf("[inspect] failed to save request for stream %d: %v", streamID, err)
+			continue
+		}
+		if truncated {
+			logger.Printf("[inspect] captured %s %s as %s, body truncated to %d bytes", c.Method, c.URI, c.ID, maxCaptureBody)
+		} else {
+			logger.Printf("[inspect] captured %s %s as %s", c.Method, c.URI, c.ID)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package inspect
+
+import (
+	"bytes"
+	"cli/internal/target"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrTruncated is returned by Replay for a capture whose body was cut
+// short, unless the body was replaced and Truncated cleared.
+var ErrTruncated = errors.New("only the first 1 MiB of the request body was captured, replace the body to replay it")
+
+// Replay re-sends a captured request to dest, a host:port or target URL.
+// An empty dest uses the local target the request was originally
+// forwarded to.
+func Replay(c *Capture, dest string, skipVerify bool) (*http.Response, error) {
+	if c.Truncated {
+		return nil, ErrTruncated
+	}
+	if dest == "" {
+		dest = c.Target
+	}
+	t, err := target.Parse(dest, skipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	host := c.Host
+	if host == "" {
+		host = "localhost"
+	}
+	req, err := http.NewRequest(c.Method, "http://"+host+c.URI, bytes.NewReader(c.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header = c.Header.Clone()
+	req.Header.Del("Content-Length")
+	req.Host = c.Host
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return t.Dial()
+			},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,222 @@
+package inspect
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxShownBody is how much of a request or response body the inspector
+// shows.
+const maxShownBody = 64 << 10
+
+// Handler serves the local inspector: the captured requests, each with a
+// form to replay it with edited headers and body. Only requests addressed
+// to a loopback host are answered, so other sites cannot reach it through
+// DNS rebinding.
+func Handler(skipVerify bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", handleList)
+	mux.HandleFunc("GET /requests/{id}", handleShow)
+	mux.HandleFunc("POST /requests/{id}/replay", func(w http.ResponseWriter, r *http.Request) {
+		handleReplay(w, r, skipVerify)
+	})
+	return loopbackOnly(mux)
+}
+
+func loopbackOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			http.Error(w, "the inspector only answers on localhost", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func handleList(w http.ResponseWriter, r *http.Request) {
+	captures, err := List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	render(w, listPage, captures)
+}
+
+// showData is a capture as shown with its replay form.
+type showData struct {
+	*Capture
+	Headers string // one "Name: value" per line
+	Preview string
+	Result  *replayResult
+}
+
+type replayResult struct {
+	Status string
+	Body   string
+	Error  string
+}
+
+func handleShow(w http.ResponseWriter, r *http.Request) {
+	c, err := Load(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	render(w, showPage, newShowData(c))
+}
+
+func handleReplay(w http.ResponseWriter, r *http.Request, skipVerify bool) {
+	// the inspector listens on loopback; refuse forms posted by other sites
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			http.Error(w, "cross-origin replay refused", http.StatusForbidden)
+			return
+		}
+	}
+
+	c, err := Load(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	data := newShowData(c)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	replayed := *c
+	// the list's replay buttons send neither field: replay as captured
+	if _, ok := r.PostForm["headers"]; ok {
+		header, err := parseHeaders(r.PostForm.Get("headers"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		replayed.Header = header
+	}
+	if body := r.PostForm.Get("body"); body != "" {
+		replayed.Body = []byte(body)
+		replayed.Truncated = false
+	}
+
+	data.Result = &replayResult{}
+	res, err := Replay(&replayed, "", skipVerify)
+	if err != nil {
+		data.Result.Error = err.Error()
+	} else {
+		defer res.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(res.Body, maxShownBody+1))
+		data.Result.Status = res.Status
+		data.Result.Body = preview(body, len(body) > maxShownBody)
+	}
+	render(w, showPage, data)
+}
+
+func newShowData(c *Capture) *showData {
+	var lines []string
+	for name, values := range c.Header {
+		for _, v := range values {
+			lines = append(lines, name+": "+v)
+		}
+	}
+	sort.Strings(lines)
+	return &showData{
+		Capture: c,
+		Headers: strings.Join(lines, "\n"),
+		Preview: preview(c.Body, c.Truncated),
+	}
+}
+
+// preview returns body for display, or a note when it is binary.
+func preview(body []byte, truncated bool) string {
+	if !utf8.Valid(body) {
+		return fmt.Sprintf("(%d bytes of binary data)", len(body))
+	}
+	if len(body) > maxShownBody {
+		body, truncated = body[:maxShownBody], true
+	}
+	if truncated {
+		return string(body) + "\n… (truncated)"
+	}
+	return string(body)
+}
+
+// parseHeaders reads one "Name: value" header per line.
+func parseHeaders(s string) (http.Header, error) {
+	header := make(http.Header)
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", line)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return header, sc.Err()
+}
+
+func render(w http.ResponseWriter, t *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = t.Execute(w, data) // the page is fully built from loaded data
+}
+
+const pageHead = `<!doctype html>
+<html><head><meta charset="utf-8"><title>selfgrok inspector</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: .3em .8em; text-align: left; border-bottom: 1px solid #ddd; }
+pre, textarea { font-family: monospace; width: 100%; max-width: 60em; }
+.warn { color: #a60; }
+.err { color: #b00; }
+</style></head><body>
+<h1><a href="/">selfgrok inspector</a></h1>
+`
+
+var listPage = template.Must(template.New("list").Parse(pageHead + `
+{{if not .}}<p>No captured requests. Start a tunnel with --inspect to capture them.</p>{{else}}
+<table>
+<tr><th>Time</th><th>Method</th><th>URI</th><th></th></tr>
+{{range .}}<tr>
+<td>{{.Time.Format "15:04:05"}}</td><td>{{.Method}}</td>
+<td><a href="/requests/{{.ID}}">{{.URI}}</a>{{if .Truncated}} <span class="warn">(body truncated)</span>{{end}}</td>
+<td><form method="post" action="/requests/{{.ID}}/replay"><button{{if .Truncated}} disabled{{end}}>Replay</button></form></td>
+</tr>{{end}}
+</table>{{end}}
+</body></html>`))
+
+var showPage = template.Must(template.New("show").Parse(pageHead + `
+<h2>{{.Method}} {{.URI}}</h2>
+<p>{{.Time.Format "2006-01-02 15:04:05"}}, host {{.Host}}, to {{.Target}}</p>
+{{with .Result}}
+<h3>Replay</h3>
+{{if .Error}}<p class="err">{{.Error}}</p>{{else}}<p>{{.Status}}</p><pre>{{.Body}}</pre>{{end}}
+{{end}}
+<h3>Body</h3>
+{{if .Truncated}}<p class="warn">Only the first 1 MiB of the body was captured. Paste the full body below to replay it.</p>{{end}}
+<pre>{{.Preview}}</pre>
+<form method="post" action="/requests/{{.ID}}/replay">
+<h3>Headers</h3>
+<textarea name="headers" rows="12">{{.Headers}}</textarea>
+<h3>Replace body</h3>
+<textarea name="body" rows="8" placeholder="leave empty to send the captured body"></textarea>
+<p><button>Replay</button></p>
+</form>
+</body></html>`))
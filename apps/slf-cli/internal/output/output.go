@@ -0,0 +1,168 @@
+package output
+
+import (
+	"cli/internal/api"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Exit codes, documented in the README.
+const (
+	ExitOK         = 0
+	ExitError      = 1
+	ExitAuth       = 2 // token missing or rejected
+	ExitNoPorts    = 3 // server has no free ports
+	ExitTargetDown = 4 // local target not reachable
+	ExitQuota      = 5 // transfer quota used up
+)
+
+// Event types emitted in JSON mode.
+const (
+	EventSessionCreated = "session_created"
+	EventConnected      = "connected"
+	EventReconnecting   = "reconnecting"
+	EventStreamOpened   = "stream_opened"
+	EventStreamClosed   = "stream_closed"
+	EventError          = "error"
+)
+
+var ErrTargetDown = errors.New("local target is not reachable")
+
+// Event is one line of JSON output.
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Session string    `json:"session,omitempty"`
+	Address string    `json:"address,omitempty"` // public host:port
+	Stream  uint32    `json:"stream,omitempty"`
+	Remote  string    `json:"remote,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Code    int       `json:"code,omitempty"` // exit code of error events
+}
+
+var (
+	format = FormatText
+	mu     sync.Mutex
+)
+
+func SetFormat(f string) error {
+	switch f {
+	case FormatText, FormatJSON:
+		format = f
+		return nil
+	default:
+		return fmt.Errorf("invalid output format %q, expected text or json", f)
+	}
+}
+
+func IsJSON() bool {
+	return format == FormatJSON
+}
+
+// Emit writes e as a JSON line in JSON mode and does nothing otherwise.
+func Emit(e Event) {
+	if !IsJSON() {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(e)
+}
+
+// Result writes v, the result of a command, as a JSON line in JSON mode
+// and does nothing otherwise. v should carry a "type" like events do.
+func Result(v any) {
+	if !IsJSON() {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v)
+}
+
+// Println prints human-readable text, suppressed in JSON mode.
+func Println(a ...any) {
+	if !IsJSON() {
+		fmt.Println(a...)
+	}
+}
+
+// Printf is Println with formatting.
+func Printf(f string, a ...any) {
+	if !IsJSON() {
+		fmt.Printf(f, a...)
+	}
+}
+
+// codedError is an error with an explicit exit code.
+type codedError struct {
+	err  error
+	code int
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// WithCode makes ExitCode report code for err.
+func WithCode(err error, code int) error {
+	return &codedError{err: err, code: code}
+}
+
+// ExitCode maps an error to the documented exit code.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	if errors.Is(err, ErrTargetDown) {
+		return ExitTargetDown
+	}
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) {
+		if apiErr.Unauthorized() {
+			return ExitAuth
+		}
+		switch apiErr.Code {
+		case "no_ports_available":
+			return ExitNoPorts
+		case "quota_exceeded":
+			return ExitQuota
+		}
+	}
+	return ExitError
+}
+
+// Fail reports err and exits with its exit code.
+func Fail(err error) {
+	FailCode(err, ExitCode(err))
+}
+
+// FailCode reports err and exits with code.
+func FailCode(err error, code int) {
+	if IsJSON() {
+		Emit(Event{Type: EventError, Error: err.Error(), Code: code})
+	} else {
+		fmt.Println("Error:", err)
+	}
+	os.Exit(code)
+}
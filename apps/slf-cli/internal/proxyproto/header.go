@@ -0,0 +1,83 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+)
+
+const (
+	V1 = "v1"
+	V2 = "v2"
+)
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Header builds a PROXY protocol header announcing a connection from src
+// to dst. Addresses that cannot be parsed produce an UNKNOWN (v1) or
+// LOCAL (v2) header, so the local service still gets a valid preamble.
+func Header(version, src, dst string) ([]byte, error) {
+	srcAddr, srcErr := parse(src)
+	dstAddr, dstErr := parse(dst)
+	known := srcErr == nil && dstErr == nil && srcAddr.Addr().Is4() == dstAddr.Addr().Is4()
+
+	switch version {
+	case V1:
+		return v1(srcAddr, dstAddr, known), nil
+	case V2:
+		return v2(srcAddr, dstAddr, known), nil
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol version %q", version)
+	}
+}
+
+func parse(s string) (netip.AddrPort, error) {
+	ap, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return ap, err
+	}
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port()), nil
+}
+
+func v1(src, dst netip.AddrPort, known bool) []byte {
+	if !known {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+
+	family := "TCP4"
+	if !src.Addr().Is4() {
+		family = "TCP6"
+	}
+	return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n",
+		family, src.Addr(), dst.Addr(), src.Port(), dst.Port())
+}
+
+func v2(src, dst netip.AddrPort, known bool) []byte {
+	var buf bytes.Buffer
+	buf.Write(v2Signature)
+
+	if !known {
+		buf.Write([]byte{0x20, 0x00, 0x00, 0x00}) // LOCAL, UNSPEC
+		return buf.Bytes()
+	}
+
+	var addrs []byte
+	family := byte(0x11) // TCP over IPv4
+	if src.Addr().Is4() {
+		s, d := src.Addr().As4(), dst.Addr().As4()
+		addrs = append(s[:], d[:]...)
+	} else {
+		family = 0x21 // TCP over IPv6
+		s, d := src.Addr().As16(), dst.Addr().As16()
+		addrs = append(s[:], d[:]...)
+	}
+	addrs = binary.BigEndian.AppendUint16(addrs, src.Port())
+	addrs = binary.BigEndian.AppendUint16(addrs, dst.Port())
+
+	buf.WriteByte(0x21) // version 2, PROXY
+	buf.WriteByte(family)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len(addrs)))
+	buf.Write(addrs)
+	return buf.Bytes()
+}
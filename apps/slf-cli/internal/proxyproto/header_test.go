@@ -0,0 +1,134 @@
+package proxyproto_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"cli/internal/proxyproto"
+)
+
+// readHeader parses a v1 or v2 header the way a receiving service would,
+// returning the source and destination, or ok false for UNKNOWN/LOCAL.
+func readHeader(t *testing.T, header []byte) (src, dst netip.AddrPort, ok bool) {
+	t.Helper()
+	r := bufio.NewReader(bytes.NewReader(header))
+
+	if bytes.HasPrefix(header, []byte("PROXY ")) {
+		line, err := r.ReadString('\n')
+		if err != nil || !strings.HasSuffix(line, "\r\n") {
+			t.Fatalf("v1 header not terminated by CRLF: %q", header)
+		}
+		fields := strings.Fields(line)
+		if fields[1] == "UNKNOWN" {
+			return src, dst, false
+		}
+		if len(fields) != 6 {
+			t.Fatalf("malformed v1 header %q", line)
+		}
+		src = netip.AddrPortFrom(netip.MustParseAddr(fields[2]), port(t, fields[4]))
+		dst = netip.AddrPortFrom(netip.MustParseAddr(fields[3]), port(t, fields[5]))
+		if want := map[bool]string{true: "TCP4", false: "TCP6"}[src.Addr().Is4()]; fields[1] != want {
+			t.Errorf("family %s for %s, want %s", fields[1], src, want)
+		}
+		return src, dst, true
+	}
+
+	sig := make([]byte, 12)
+	io.ReadFull(r, sig)
+	if string(sig) != "\r\n\r\n\x00\r\nQUIT\n" {
+		t.Fatalf("header has neither v1 nor v2 signature: %q", header)
+	}
+	var hdr struct {
+		VerCmd, Family byte
+		Length         uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		t.Fatalf("short v2 header: %v", err)
+	}
+	if hdr.VerCmd>>4 != 2 {
+		t.Fatalf("v2 header with version %d", hdr.VerCmd>>4)
+	}
+	addrs := make([]byte, hdr.Length)
+	if _, err := io.ReadFull(r, addrs); err != nil || r.Buffered() != 0 {
+		t.Fatalf("v2 length %d does not match the header %x", hdr.Length, header)
+	}
+	if hdr.VerCmd&0x0f == 0 {
+		return src, dst, false
+	}
+
+	n := 4
+	if hdr.Family == 0x21 {
+		n = 16
+	} else if hdr.Family != 0x11 {
+		t.Fatalf("unexpected v2 family %#x", hdr.Family)
+	}
+	if len(addrs) != 2*n+4 {
+		t.Fatalf("v2 address block of %d bytes for family %#x", len(addrs), hdr.Family)
+	}
+	srcIP, _ := netip.AddrFromSlice(addrs[:n])
+	dstIP, _ := netip.AddrFromSlice(addrs[n : 2*n])
+	src = netip.AddrPortFrom(srcIP, binary.BigEndian.Uint16(addrs[2*n:]))
+	dst = netip.AddrPortFrom(dstIP, binary.BigEndian.Uint16(addrs[2*n+2:]))
+	return src, dst, true
+}
+
+func port(t *testing.T, s string) uint16 {
+	t.Helper()
+	var p uint16
+	if _, err := fmt.Sscan(s, &p); err != nil {
+		t.Fatalf("bad port %q", s)
+	}
+	return p
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, dst string
+		known    bool
+		wantSrc  string // src as read back, when it differs from src
+	}{
+		{name: "ipv4", src: "203.0.113.7:51000", dst: "10.0.0.1:443", known: true},
+		{name: "ipv6", src: "[2001:db8::7]:51000", dst: "[2001:db8::1]:443", known: true},
+		{name: "mapped ipv4", src: "[::ffff:203.0.113.7]:51000", dst: "10.0.0.1:443", known: true, wantSrc: "203.0.113.7:51000"},
+		{name: "mixed families", src: "203.0.113.7:51000", dst: "[2001:db8::1]:443"},
+		{name: "missing source", src: "", dst: "10.0.0.1:443"},
+		{name: "hostname", src: "client.example:51000", dst: "10.0.0.1:443"},
+	}
+	for _, version := range []string{proxyproto.V1, proxyproto.V2} {
+		for _, tt := range tests {
+			t.Run(version+" "+tt.name, func(t *testing.T) {
+				header, err := proxyproto.Header(version, tt.src, tt.dst)
+				if err != nil {
+					t.Fatalf("Header: %v", err)
+				}
+				src, dst, known := readHeader(t, header)
+				if known != tt.known {
+					t.Fatalf("known = %v, want %v (header %q)", known, tt.known, header)
+				}
+				if !known {
+					return
+				}
+				wantSrc := tt.src
+				if tt.wantSrc != "" {
+					wantSrc = tt.wantSrc
+				}
+				if src.String() != wantSrc || dst.String() != tt.dst {
+					t.Errorf("read back %s -> %s, want %s -> %s", src, dst, wantSrc, tt.dst)
+				}
+			})
+		}
+	}
+}
+
+func TestHeaderRejectsUnknownVersion(t *testing.T) {
+	if _, err := proxyproto.Header("v3", "203.0.113.7:51000", "10.0.0.1:443"); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+}
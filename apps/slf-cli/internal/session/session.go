@@ -3,45 +3,281 @@ package session
 import (
 	"cli/internal/api"
 	"cli/internal/connector"
+	"cli/internal/dashboard"
+	"cli/internal/output"
+	"cli/internal/target"
+	"cli/internal/upstream"
 	"fmt"
+	"log"
+	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
-func Start(host, port string) error {
+type Options struct {
+	Host          string
+	Port          string
+	Target        string // target URL, overrides Host and Port
+	TLSSkipVerify bool
+	Inspect       bool
+	ProxyProtocol string
+	AllowForward  bool
+	Dial          func() (net.Conn, error) // serve streams in-process instead of Host:Port
+	Log           *log.Logger              // tunnel log lines, the standard logger when nil
+	MaxReconnects int                      // failed re-attach attempts before giving up, zero for unlimited
+	DialTimeout   time.Duration            // for local services, target.DefaultDialTimeout when zero
+	Stats         *connector.Stats         // collects counters for a status view when set
+	Dashboard     bool                     // Start shows a live status view instead of log lines
+
+	// Upstreams, when set, replace Host, Port and Target with several local
+	// services picked by UpstreamPolicy.
+	Upstreams      []string
+	UpstreamPolicy string        // failover | round-robin
+	HealthCheck    string        // tcp | http
+	HealthPath     string        // path for http health checks
+	HealthInterval time.Duration // between health checks, zero disables them
+
+	Connection api.ConnectionOptions
+}
+
+// Tunnel is one exposed local service with its server connection.
+type Tunnel struct {
+	opts        Options
+	client      *api.Client
+	conn        *api.Connection
+	localTarget string
+	pool        *upstream.Pool
+	stop        chan struct{}
+	closeOnce   sync.Once
+}
+
+// upstreams returns the local services streams go to. The first one also
+// hosts the ports forwarded streams ask for.
+func upstreams(opts Options) ([]*upstream.Upstream, error) {
+	if opts.Dial != nil {
+		return []*upstream.Upstream{{Name: net.JoinHostPort(opts.Host, opts.Port), Dial: opts.Dial}}, nil
+	}
+
+	targets := opts.Upstreams
+	if len(targets) == 0 {
+		t := opts.Target
+		if t == "" {
+			t = net.JoinHostPort(opts.Host, opts.Port)
+		}
+		targets = []string{t}
+	}
+
+	var list []*upstream.Upstream
+	for _, s := range targets {
+		tgt, err := target.Parse(s, opts.TLSSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		tgt.Timeout = opts.DialTimeout
+		list = append(list, &upstream.Upstream{Name: tgt.String(), Dial: tgt.Dial})
+	}
+	return list, nil
+}
+
+// CheckTarget makes sure a local target accepts connections before a
+// session is created for it. UDP targets are not checked.
+func CheckTarget(opts Options) error {
+	if opts.Connection.Protocol == "udp" {
+		return nil
+	}
+	list, err := upstreams(opts)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, u := range list {
+		conn, err := u.Dial()
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		names = append(names, u.Name)
+		if len(list) == 1 {
+			return fmt.Errorf("%w: %s: %v", output.ErrTargetDown, u.Name, err)
+		}
+	}
+	return fmt.Errorf("%w: none of %s", output.ErrTargetDown, strings.Join(names, ", "))
+}
+
+// Open creates the tunnel's connection on the server.
+func Open(client *api.Client, opts Options) (*Tunnel, error) {
+	list, err := upstreams(opts)
+	if err != nil {
+		return nil, err
+	}
+	logger := opts.Log
+	if logger == nil {
+		logger = log.Default()
+	}
+	pool, err := upstream.NewPool(upstream.Config{
+		Policy:    opts.UpstreamPolicy,
+		Check:     opts.HealthCheck,
+		CheckPath: opts.HealthPath,
+		Interval:  opts.HealthInterval,
+		Log:       logger.Printf,
+	}, list...)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tunnel{
+		opts:        opts,
+		client:      client,
+		localTarget: list[0].Name,
+		pool:        pool,
+		stop:        make(chan struct{}),
+	}
+
+	conn, err := client.CreateConnection(&opts.Connection)
+	if err != nil {
+		return nil, fmt.Errorf("connection create failed: %w", err)
+	}
+	t.conn = conn
+	created := output.Event{Type: output.EventSessionCreated, Session: conn.ID}
+	if conn.ShareToken == "" {
+		created.Address = net.JoinHostPort(conn.Address, strconv.Itoa(conn.ExternalPort))
+	}
+	output.Emit(created)
+	return t, nil
+}
+
+func (t *Tunnel) Connection() *api.Connection {
+	return t.conn
+}
+
+// Dashboard returns the tunnel as shown on a dashboard. Its options must
+// carry Stats.
+func (t *Tunnel) Dashboard(name string) dashboard.Tunnel {
+	dt := dashboard.Tunnel{Name: name, ShareToken: t.conn.ShareToken, Stats: t.opts.Stats}
+	if t.conn.ShareToken == "" {
+		dt.Address = net.JoinHostPort(t.conn.Address, strconv.Itoa(t.conn.ExternalPort))
+	}
+	return dt
+}
+
+// Run carries the tunnel's streams, re-attaching after network failures,
+// until Close is called or reconnecting gives up.
+func (t *Tunnel) Run() error {
+	var health connector.HealthReporter
+	if t.opts.Connection.Protocol != "udp" {
+		go t.pool.Run(t.stop)
+		health = t.pool
+	}
+	err := connector.ConnectAndRun(connector.Options{
+		LocalTarget:   t.localTarget,
+		Inspect:       t.opts.Inspect,
+		ProxyProtocol: t.opts.ProxyProtocol,
+		AllowForward:  t.opts.AllowForward,
+		Dial:          t.pool.Dial,
+		DialTimeout:   t.opts.DialTimeout,
+		Log:           t.opts.Log,
+		Stats:         t.opts.Stats,
+		Health:        health,
+		Reconnect:     connector.ReconnectPolicy{MaxAttempts: t.opts.MaxReconnects},
+		Stop:          t.stop,
+	}, t.client, t.conn)
+	if err != nil {
+		return fmt.Errorf("connector run failed: %w", err)
+	}
+	return nil
+}
+
+// Close removes the tunnel's connection. An agent that joined someone
+// else's session leaves it running.
+func (t *Tunnel) Close() {
+	t.closeOnce.Do(func() {
+		close(t.stop)
+		if t.opts.Connection.Join == "" {
+			_ = t.client.DeleteConnection(t.conn.ID)
+		}
+	})
+}
+
+func Start(opts Options) error {
 	client, err := api.New()
 	if err != nil {
 		return fmt.Errorf("API client init failed: %w", err)
 	}
-	fmt.Println("\nAPI client initialized")
-	fmt.Println("\nCreating session...")
+	output.Println("\nAPI client initialized")
+	output.Println("\nCreating session...")
 
-	conn, err := client.CreateConnection()
+	var dash *dashboard.Dashboard
+	if opts.Dashboard {
+		dash = dashboard.New(os.Stdout)
+		opts.Stats = connector.NewStats()
+		if opts.Log != nil {
+			// the caller may share it, e.g. with an in-process server
+			opts.Log.SetOutput(dash)
+		} else {
+			opts.Log = log.New(dash, "", log.LstdFlags)
+		}
+	}
+
+	t, err := Open(client, opts)
 	if err != nil {
-		return fmt.Errorf("connection create failed: %w", err)
+		return err
+	}
+
+	if dash != nil {
+		dash.Add(t.Dashboard(""))
+		dash.Start()
+		defer dash.Stop()
 	}
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
-	localTarget := fmt.Sprintf("%s:%s", host, port)
-
 	go func() {
 		<-stop
-		fmt.Println("\nShutting down session...")
-		_ = client.DeleteConnection(conn.ID)
+		if dash != nil {
+			dash.Stop()
+		}
+		output.Println("\nShutting down session...")
+		t.Close()
 		os.Exit(0)
 	}()
 
-	err = connector.ConnectAndRun(localTarget, client, conn)
+	err = t.Run()
+	t.Close()
+	return err
+}
+
+// Forward opens a forward session and carries connections accepted on
+// opts.Local to opts.Remote until interrupted or reconnecting gives up.
+func Forward(opts connector.ForwardOptions) error {
+	client, err := api.New()
 	if err != nil {
-		fmt.Println("Connector run failed:", err)
-		_ = client.DeleteConnection(conn.ID)
-		return fmt.Errorf("connector run failed: %w", err)
+		return fmt.Errorf("API client init failed: %w", err)
 	}
+	output.Println("\nCreating forward session...")
 
-	_ = client.DeleteConnection(conn.ID)
-	return fmt.Errorf("connector start failed: %w", err)
+	conn, err := client.CreateConnection(&api.ConnectionOptions{Mode: "forward"})
+	if err != nil {
+		return fmt.Errorf("connection create failed: %w", err)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
 
+	stop := make(chan struct{})
+	go func() {
+		<-sig
+		output.Println("\nShutting down forward...")
+		close(stop)
+	}()
+
+	opts.Stop = stop
+	err = connector.Forward(opts, client, conn)
+	_ = client.DeleteConnection(conn.ID)
+	return err
 }
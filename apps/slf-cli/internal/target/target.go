@@ -0,0 +1,96 @@
+package target
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultDialTimeout bounds dials to local services unless a target sets
+// its own.
+const DefaultDialTimeout = 10 * time.Second
+
+// Target is the local service a session forwards streams to.
+type Target struct {
+	Network string // tcp | unix
+	Address string // host:port, or the socket path for unix
+	TLS     *tls.Config
+	Timeout time.Duration // DefaultDialTimeout when zero
+}
+
+// Parse reads a target such as "127.0.0.1:3000", "tcp://host:port",
+// "unix:///var/run/docker.sock" or "tls://localhost:8443". Socket paths
+// are taken verbatim after "unix:" or "unix://", so "unix:app.sock" and
+// "unix://app.sock" are relative. skipVerify disables certificate checks
+// for tls targets.
+func Parse(s string, skipVerify bool) (*Target, error) {
+	if rest, ok := strings.CutPrefix(s, "unix:"); ok {
+		path := strings.TrimPrefix(rest, "//")
+		if path == "" {
+			return nil, fmt.Errorf("invalid target %q: missing socket path", s)
+		}
+		return &Target{Network: "unix", Address: path}, nil
+	}
+	if !strings.Contains(s, "://") {
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			return nil, fmt.Errorf("invalid target %q: %w", s, err)
+		}
+		return &Target{Network: "tcp", Address: s}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %q: %w", s, err)
+	}
+
+	switch u.Scheme {
+	case "tcp":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("invalid target %q: missing port", s)
+		}
+		return &Target{Network: "tcp", Address: u.Host}, nil
+	case "tls":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("invalid target %q: missing port", s)
+		}
+		return &Target{
+			Network: "tcp",
+			Address: u.Host,
+			TLS: &tls.Config{
+				ServerName:         u.Hostname(),
+				InsecureSkipVerify: skipVerify,
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported target scheme %q (expected tcp, unix or tls)", u.Scheme)
+	}
+}
+
+// Dial connects to the target, completing the TLS handshake for tls
+// targets.
+func (t *Target) Dial() (net.Conn, error) {
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDialTimeout
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	if t.TLS != nil {
+		return tls.DialWithDialer(dialer, t.Network, t.Address, t.TLS)
+	}
+	return dialer.Dial(t.Network, t.Address)
+}
+
+// String returns the target in URL form.
+func (t *Target) String() string {
+	switch {
+	case t.Network == "unix":
+		return "unix://" + t.Address
+	case t.TLS != nil:
+		return "tls://" + t.Address
+	default:
+		return t.Address
+	}
+}
@@ -0,0 +1,75 @@
+package target_test
+
+import (
+	"testing"
+
+	"cli/internal/target"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		network string
+		address string
+		tls     string // expected ServerName, empty for plain targets
+		str     string
+	}{
+		{in: "127.0.0.1:3000", network: "tcp", address: "127.0.0.1:3000", str: "127.0.0.1:3000"},
+		{in: "localhost:3000", network: "tcp", address: "localhost:3000", str: "localhost:3000"},
+		{in: "[::1]:3000", network: "tcp", address: "[::1]:3000", str: "[::1]:3000"},
+		{in: "tcp://db:5432", network: "tcp", address: "db:5432", str: "db:5432"},
+		{in: "tcp://[fe80::1]:5432", network: "tcp", address: "[fe80::1]:5432", str: "[fe80::1]:5432"},
+		{in: "unix:///var/run/docker.sock", network: "unix", address: "/var/run/docker.sock", str: "unix:///var/run/docker.sock"},
+		{in: "unix:/var/run/docker.sock", network: "unix", address: "/var/run/docker.sock", str: "unix:///var/run/docker.sock"},
+		{in: "unix:app.sock", network: "unix", address: "app.sock", str: "unix://app.sock"},
+		{in: "unix://run/app.sock", network: "unix", address: "run/app.sock", str: "unix://run/app.sock"},
+		{in: "unix:///tmp/a%20b.sock", network: "unix", address: "/tmp/a%20b.sock", str: "unix:///tmp/a%20b.sock"},
+		{in: "tls://localhost:8443", network: "tcp", address: "localhost:8443", tls: "localhost", str: "tls://localhost:8443"},
+		{in: "tls://[::1]:8443", network: "tcp", address: "[::1]:8443", tls: "::1", str: "tls://[::1]:8443"},
+	}
+	for _, tt := range tests {
+		got, err := target.Parse(tt.in, false)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got.Network != tt.network || got.Address != tt.address {
+			t.Errorf("Parse(%q) = %s %s, want %s %s", tt.in, got.Network, got.Address, tt.network, tt.address)
+		}
+		switch {
+		case tt.tls == "" && got.TLS != nil:
+			t.Errorf("Parse(%q) enabled TLS", tt.in)
+		case tt.tls != "" && (got.TLS == nil || got.TLS.ServerName != tt.tls):
+			t.Errorf("Parse(%q) TLS = %+v, want ServerName %q", tt.in, got.TLS, tt.tls)
+		}
+		if s := got.String(); s != tt.str {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.in, s, tt.str)
+		}
+	}
+}
+
+func TestParseSkipVerify(t *testing.T) {
+	got, err := target.Parse("tls://localhost:8443", true)
+	if err != nil || !got.TLS.InsecureSkipVerify {
+		t.Errorf("expected InsecureSkipVerify, got %+v (%v)", got, err)
+	}
+}
+
+func TestParseRejectsInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"3000",
+		"localhost",
+		"::1:3000",
+		"tcp://localhost",
+		"tls://localhost",
+		"tls://[::1]",
+		"unix:",
+		"unix://",
+		"http://localhost:3000",
+	} {
+		if got, err := target.Parse(in, false); err == nil {
+			t.Errorf("Parse(%q) = %+v, expected an error", in, got)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package tunnel
+
+import (
+	"cli/internal/api"
+	"cli/internal/config"
+	"cli/internal/proxyproto"
+	"cli/internal/session"
+	"cli/internal/target"
+	"cli/internal/upstream"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options validates a tunnel and turns it into session options.
+func Options(t config.Tunnel) (session.Options, error) {
+	var opts session.Options
+
+	if t.Port == "" && t.Target == "" && len(t.Upstreams) == 0 {
+		return opts, fmt.Errorf("please provide port, target or upstreams for expose")
+	}
+
+	for _, u := range t.Upstreams {
+		if _, err := target.Parse(u, t.TLSSkipVerify); err != nil {
+			return opts, err
+		}
+	}
+
+	for _, list := range [][]string{t.AllowCIDRs, t.DenyCIDRs, t.OAuthProxies} {
+		for _, cidr := range list {
+			if err := validateCIDR(cidr); err != nil {
+				return opts, err
+			}
+		}
+	}
+	if len(t.Upstreams) > 0 && t.Protocol == "udp" {
+		return opts, fmt.Errorf("udp tunnels take a single host:port target")
+	}
+
+	switch t.UpstreamPolicy {
+	case "", upstream.PolicyFailover, upstream.PolicyRoundRobin:
+	default:
+		return opts, fmt.Errorf("invalid upstream policy, expected failover or round-robin")
+	}
+	switch t.HealthCheck {
+	case "", upstream.CheckTCP, upstream.CheckHTTP:
+	default:
+		return opts, fmt.Errorf("invalid health check, expected tcp or http")
+	}
+	var healthInterval time.Duration
+	if t.HealthInterval != "" && t.HealthInterval != "off" {
+		d, err := time.ParseDuration(t.HealthInterval)
+		if err != nil || d < 0 {
+			return opts, fmt.Errorf("invalid health interval %q, expected a duration like 10s or off", t.HealthInterval)
+		}
+		healthInterval = d
+	}
+
+	timeouts := []struct{ name, value string }{
+		{"dial timeout", t.DialTimeout},
+		{"agent wait", t.AgentWait},
+		{"stream idle timeout", t.StreamIdleTimeout},
+		{"stream max lifetime", t.StreamMaxLifetime},
+		{"session idle timeout", t.SessionIdleTimeout},
+	}
+	for _, to := range timeouts {
+		if to.value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(to.value); err != nil || d <= 0 {
+			return opts, fmt.Errorf("invalid %s %q, expected a duration like 30s", to.name, to.value)
+		}
+	}
+	dialTimeout, _ := time.ParseDuration(t.DialTimeout) // zero when unset
+
+	if t.Target != "" {
+		tgt, err := target.Parse(t.Target, t.TLSSkipVerify)
+		if err != nil {
+			return opts, err
+		}
+		if t.Protocol == "udp" && (tgt.Network != "tcp" || tgt.TLS != nil) {
+			return opts, fmt.Errorf("udp tunnels need a host:port target")
+		}
+	}
+
+	if t.ProxyProtocol != "" && t.ProxyProtocol != proxyproto.V1 && t.ProxyProtocol != proxyproto.V2 {
+		return opts, fmt.Errorf("invalid proxy protocol, expected v1 or v2")
+	}
+
+	opts = session.Options{
+		Host:          t.Host,
+		Port:          t.Port,
+		Target:        t.Target,
+		TLSSkipVerify: t.TLSSkipVerify,
+		Inspect:       t.Inspect,
+		ProxyProtocol: t.ProxyProtocol,
+		AllowForward:  t.AllowForward,
+		MaxReconnects: t.MaxReconnects,
+		DialTimeout:   dialTimeout,
+
+		Upstreams:      t.Upstreams,
+		UpstreamPolicy: t.UpstreamPolicy,
+		HealthCheck:    t.HealthCheck,
+		HealthPath:     t.HealthPath,
+		HealthInterval: healthInterval,
+
+		Connection: api.ConnectionOptions{
+			Protocol:   t.Protocol,
+			Join:       t.Join,
+			Balance:    t.Balance,
+			AllowCIDRs: t.AllowCIDRs,
+			DenyCIDRs:  t.DenyCIDRs,
+		},
+	}
+
+	if t.RateLimit > 0 || t.RateLimitPerIP > 0 || t.MaxConns > 0 {
+		opts.Connection.RateLimit = &api.RateLimit{
+			ConnsPerSecond:      t.RateLimit,
+			PerIPConnsPerSecond: t.RateLimitPerIP,
+			MaxConns:            t.MaxConns,
+		}
+	}
+
+	if t.AgentWait != "" || t.StreamIdleTimeout != "" || t.StreamMaxLifetime != "" || t.SessionIdleTimeout != "" {
+		opts.Connection.Timeouts = &api.Timeouts{
+			AgentWait:      t.AgentWait,
+			StreamIdle:     t.StreamIdleTimeout,
+			StreamLifetime: t.StreamMaxLifetime,
+			SessionIdle:    t.SessionIdleTimeout,
+		}
+	}
+
+	bandwidth, err := bandwidthLimits(t)
+	if err != nil {
+		return opts, err
+	}
+	opts.Connection.Bandwidth = bandwidth
+
+	access := &api.AccessPolicy{BearerToken: t.BearerToken, OAuthHeader: t.OAuthHeader, OAuthProxies: t.OAuthProxies}
+	if access.OAuthHeader != "" && len(access.OAuthProxies) == 0 {
+		return opts, fmt.Errorf("--oauth-header needs --oauth-proxy with the CIDRs of the OAuth proxy, otherwise any client could set it")
+	}
+	if t.BasicAuth != "" {
+		user, pass, ok := strings.Cut(t.BasicAuth, ":")
+		if !ok || user == "" {
+			return opts, fmt.Errorf("invalid basic auth, expected user:password")
+		}
+		access.BasicAuth = &api.BasicAuth{Username: user, Password: pass}
+	}
+	if access.BasicAuth != nil || access.BearerToken != "" || access.OAuthHeader != "" {
+		opts.Connection.Access = access
+		opts.Connection.Protocol = "http"
+	}
+
+	headers, err := headerRules(t)
+	if err != nil {
+		return opts, err
+	}
+	if headers != nil {
+		opts.Connection.Headers = headers
+		opts.Connection.Protocol = "http"
+	}
+
+	if t.ErrorPageHTML != "" || t.ErrorPageJSON != "" {
+		html, err := readErrorPage(t.ErrorPageHTML)
+		if err != nil {
+			return opts, err
+		}
+		json, err := readErrorPage(t.ErrorPageJSON)
+		if err != nil {
+			return opts, err
+		}
+		opts.Connection.ErrorPages = &api.ErrorPages{HTML: html, JSON: json}
+		opts.Connection.Protocol = "http"
+	}
+
+	switch t.Balance {
+	case "", "round-robin", "least-conns", "sticky":
+	default:
+		return opts, fmt.Errorf("invalid balance policy, expected round-robin, least-conns or sticky")
+	}
+
+	if t.Private {
+		if opts.Connection.Protocol != "tcp" {
+			return opts, fmt.Errorf("private sessions only carry raw TCP")
+		}
+		opts.Connection.Mode = "private"
+	}
+
+	if t.Protocol == "udp" && opts.Connection.Protocol != "udp" {
+		return opts, fmt.Errorf("access, header and error page options are only available for HTTP tunnels")
+	}
+
+	return opts, nil
+}
+
+func bandwidthLimits(t config.Tunnel) (*api.Bandwidth, error) {
+	up, err := parseBytes(t.BandwidthUp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bandwidth up: %w", err)
+	}
+	down, err := parseBytes(t.BandwidthDown)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bandwidth down: %w", err)
+	}
+	if up == 0 && down == 0 {
+		return nil, nil
+	}
+	return &api.Bandwidth{UpBytesPerSec: up, DownBytesPerSec: down}, nil
+}
+
+// parseBytes parses sizes like "2048", "512K", "10M" or "1G".
+func parseBytes(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a size like 512K or 10M")
+	}
+	return n * multiplier, nil
+}
+
+// localHost is the host:port the local service expects in Host headers.
+func localHost(t config.Tunnel) string {
+	if t.Target == "" {
+		return net.JoinHostPort(t.Host, t.Port)
+	}
+	tgt, err := target.Parse(t.Target, t.TLSSkipVerify)
+	if err != nil || tgt.Network == "unix" {
+		return "localhost"
+	}
+	return tgt.Address
+}
+
+func headerRules(t config.Tunnel) (*api.HeaderRules, error) {
+	rules := &api.HeaderRules{
+		Host:           t.HostHeader,
+		RequestRemove:  t.RequestHeaderRemove,
+		ResponseRemove: t.ResponseHeaderRemove,
+	}
+	if t.HostHeader == "rewrite" {
+		rules.Host = localHost(t)
+	}
+
+	var err error
+	if rules.RequestAdd, err = ParseHeaders(t.RequestHeaderAdd); err != nil {
+		return nil, err
+	}
+	if rules.ResponseAdd, err = ParseHeaders(t.ResponseHeaderAdd); err != nil {
+		return nil, err
+	}
+
+	if rules.Host == "" && rules.RequestAdd == nil && rules.ResponseAdd == nil &&
+		len(rules.RequestRemove) == 0 && len(rules.ResponseRemove) == 0 {
+		return nil, nil
+	}
+	return rules, nil
+}
+
+// ParseHeaders parses "Name: value" pairs.
+func ParseHeaders(list []string) (map[string]string, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	headers := make(map[string]string, len(list))
+	for _, h := range list {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", h)
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return headers, nil
+}
+
+// maxErrorPageSize matches the limit slf-server and the API enforce.
+const maxErrorPageSize = 64 << 10
+
+// readErrorPage reads an error page file, skipping an empty path.
+func readErrorPage(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read error page: %w", err)
+	}
+	if len(data) > maxErrorPageSize {
+		return "", fmt.Errorf("error page %s is larger than 64 KiB", path)
+	}
+	return string(data), nil
+}
+
+// validateCIDR accepts a CIDR or a single address, like slf-server does.
+func validateCIDR(s string) error {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		if _, err := netip.ParsePrefix(s); err != nil {
+			return fmt.Errorf("invalid CIDR %q", s)
+		}
+		return nil
+	}
+	if _, err := netip.ParseAddr(s); err != nil {
+		return fmt.Errorf("invalid address %q, expected an IP or CIDR", s)
+	}
+	return nil
+}
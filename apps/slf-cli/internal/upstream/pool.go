@@ -0,0 +1,225 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Policies for spreading streams across upstreams.
+const (
+	PolicyFailover   = "failover"    // first healthy upstream in list order
+	PolicyRoundRobin = "round-robin" // rotate through healthy upstreams
+)
+
+// Health check kinds.
+const (
+	CheckTCP  = "tcp"  // the upstream accepts connections
+	CheckHTTP = "http" // GET on a path answers below 500
+)
+
+const checkTimeout = 5 * time.Second
+
+// Upstream is one local service a tunnel can send streams to.
+type Upstream struct {
+	Name string // shown in logs
+	Dial func() (net.Conn, error)
+
+	mu      sync.Mutex
+	healthy bool
+	detail  string
+}
+
+func (u *Upstream) health() (bool, string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.healthy, u.detail
+}
+
+// setHealth records a check result and reports whether it changed.
+func (u *Upstream) setHealth(healthy bool, detail string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	changed := u.healthy != healthy
+	u.healthy, u.detail = healthy, detail
+	return changed
+}
+
+// Config controls a Pool.
+type Config struct {
+	Policy    string        // PolicyFailover by default
+	Check     string        // CheckTCP by default
+	CheckPath string        // path for CheckHTTP, "/" by default
+	Interval  time.Duration // between checks, zero disables them
+	Log       func(format string, args ...any)
+}
+
+// Pool picks a healthy upstream for every stream and tracks health with
+// periodic checks. Upstreams start out healthy.
+type Pool struct {
+	cfg       Config
+	upstreams []*Upstream
+	next      atomic.Uint64
+}
+
+func NewPool(cfg Config, upstreams ...*Upstream) (*Pool, error) {
+	if len(upstreams) == 0 {
+		return nil, errors.New("no upstreams")
+	}
+	switch cfg.Policy {
+	case "":
+		cfg.Policy = PolicyFailover
+	case PolicyFailover, PolicyRoundRobin:
+	default:
+		return nil, fmt.Errorf("invalid upstream policy %q, expected failover or round-robin", cfg.Policy)
+	}
+	switch cfg.Check {
+	case "":
+		cfg.Check = CheckTCP
+	case CheckTCP, CheckHTTP:
+	default:
+		return nil, fmt.Errorf("invalid health check %q, expected tcp or http", cfg.Check)
+	}
+	if cfg.CheckPath == "" {
+		cfg.CheckPath = "/"
+	}
+	if cfg.Log == nil {
+		cfg.Log = func(string, ...any) {}
+	}
+	for _, u := range upstreams {
+		u.healthy = true
+	}
+	return &Pool{cfg: cfg, upstreams: upstreams}, nil
+}
+
+// Dial connects to a healthy upstream chosen by the policy, trying the
+// others when it fails. When every upstream is marked unhealthy they are
+// all tried anyway, since the last check may be stale; the one that
+// answers is marked healthy again.
+func (p *Pool) Dial() (net.Conn, error) {
+	order := p.order()
+	var lastErr error
+	for _, u := range order {
+		conn, err := u.Dial()
+		if err == nil {
+			if u.setHealth(true, "") {
+				p.cfg.Log("[upstream] %s is reachable again", u.Name)
+			}
+			return conn, nil
+		}
+		lastErr = err
+		if u.setHealth(false, err.Error()) {
+			p.cfg.Log("[upstream] %s is down: %v", u.Name, err)
+		}
+	}
+	return nil, lastErr
+}
+
+// order lists the healthy upstreams in the order to try them, followed by
+// the unhealthy ones.
+func (p *Pool) order() []*Upstream {
+	var healthy, unhealthy []*Upstream
+	for _, u := range p.upstreams {
+		if ok, _ := u.health(); ok {
+			healthy = append(healthy, u)
+		} else {
+			unhealthy = append(unhealthy, u)
+		}
+	}
+	if p.cfg.Policy == PolicyRoundRobin && len(healthy) > 1 {
+		i := int(p.next.Add(1) % uint64(len(healthy)))
+		healthy = append(healthy[i:], healthy[:i]...)
+	}
+	return append(healthy, unhealthy...)
+}
+
+// Health reports whether any upstream is healthy, and why not otherwise.
+func (p *Pool) Health() (bool, string) {
+	var details []string
+	for _, u := range p.upstreams {
+		ok, detail := u.health()
+		if ok {
+			return true, ""
+		}
+		details = append(details, u.Name+": "+detail)
+	}
+	return false, strings.Join(details, "; ")
+}
+
+// Run checks every upstream each interval until stop is closed.
+func (p *Pool) Run(stop <-chan struct{}) {
+	if p.cfg.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		p.checkAll()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pool) checkAll() {
+	var wg sync.WaitGroup
+	for _, u := range p.upstreams {
+		wg.Add(1)
+		go func(u *Upstream) {
+			defer wg.Done()
+			err := p.check(u)
+			healthy, detail := err == nil, ""
+			if err != nil {
+				detail = err.Error()
+			}
+			if !u.setHealth(healthy, detail) {
+				return
+			}
+			if healthy {
+				p.cfg.Log("[upstream] %s is healthy again", u.Name)
+			} else {
+				p.cfg.Log("[upstream] %s failed its health check: %v", u.Name, err)
+			}
+		}(u)
+	}
+	wg.Wait()
+}
+
+func (p *Pool) check(u *Upstream) error {
+	if p.cfg.Check == CheckTCP {
+		conn, err := u.Dial()
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	client := &http.Client{
+		Timeout: checkTimeout,
+		Transport: &http.Transport{
+			DialContext: func(context.Context, string, string) (net.Conn, error) {
+				return u.Dial()
+			},
+			DisableKeepAlives: true,
+		},
+	}
+	// the host only fills the Host header, every connection goes through
+	// the upstream's own dialer
+	res, err := client.Get("http://localhost" + p.cfg.CheckPath)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 500 {
+		return fmt.Errorf("GET %s returned %s", p.cfg.CheckPath, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package upstream_test
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cli/internal/upstream"
+)
+
+// fake is an upstream whose dials succeed while up is set.
+type fake struct {
+	up    atomic.Bool
+	dials atomic.Int32
+}
+
+func newFake(name string, up bool) (*fake, *upstream.Upstream) {
+	f := &fake{}
+	f.up.Store(up)
+	return f, &upstream.Upstream{Name: name, Dial: func() (net.Conn, error) {
+		f.dials.Add(1)
+		if !f.up.Load() {
+			return nil, errors.New(name + " refused")
+		}
+		a, b := net.Pipe()
+		b.Close()
+		return a, nil
+	}}
+}
+
+func TestNewPoolRejectsInvalidConfig(t *testing.T) {
+	_, u := newFake("a", true)
+	if _, err := upstream.NewPool(upstream.Config{}); err == nil {
+		t.Error("expected an error without upstreams")
+	}
+	if _, err := upstream.NewPool(upstream.Config{Policy: "random"}, u); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+	if _, err := upstream.NewPool(upstream.Config{Check: "icmp"}, u); err == nil {
+		t.Error("expected an error for an unknown check")
+	}
+}
+
+func TestPoolFailsOverAndRecovers(t *testing.T) {
+	a, ua := newFake("a", false)
+	b, ub := newFake("b", true)
+	p, err := upstream.NewPool(upstream.Config{}, ua, ub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := p.Dial()
+	if err != nil {
+		t.Fatalf("expected failover to b, got %v", err)
+	}
+	conn.Close()
+	if a.dials.Load() != 1 || b.dials.Load() != 1 {
+		t.Fatalf("expected one dial each, got a=%d b=%d", a.dials.Load(), b.dials.Load())
+	}
+
+	// a is now marked down, so b is tried first
+	conn, _ = p.Dial()
+	conn.Close()
+	if a.dials.Load() != 1 {
+		t.Fatalf("unhealthy upstream dialed before a healthy one")
+	}
+
+	b.up.Store(false)
+	if _, err := p.Dial(); err == nil {
+		t.Fatal("expected an error with every upstream down")
+	}
+	if ok, detail := p.Health(); ok || !strings.Contains(detail, "a refused") || !strings.Contains(detail, "b refused") {
+		t.Fatalf("expected both upstreams unhealthy, got %v %q", ok, detail)
+	}
+
+	// unhealthy upstreams are still tried, and one that answers is healthy again
+	a.up.Store(true)
+	conn, err = p.Dial()
+	if err != nil {
+		t.Fatalf("expected a to answer again, got %v", err)
+	}
+	conn.Close()
+	if ok, _ := p.Health(); !ok {
+		t.Fatal("a successful dial did not mark the upstream healthy")
+	}
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	a, ua := newFake("a", true)
+	b, ub := newFake("b", true)
+	p, err := upstream.NewPool(upstream.Config{Policy: upstream.PolicyRoundRobin}, ua, ub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		conn, err := p.Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+	if a.dials.Load() != 2 || b.dials.Load() != 2 {
+		t.Fatalf("expected dials spread evenly, got a=%d b=%d", a.dials.Load(), b.dials.Load())
+	}
+}
+
+func TestPoolHTTPCheck(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	u := &upstream.Upstream{Name: "web", Dial: func() (net.Conn, error) {
+		return net.Dial("tcp", srv.Listener.Addr().String())
+	}}
+	p, err := upstream.NewPool(upstream.Config{Check: upstream.CheckHTTP, CheckPath: "/healthz", Interval: 10 * time.Millisecond}, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go p.Run(stop)
+
+	waitHealth := func(want bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if ok, _ := p.Health(); ok == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("health did not become %v", want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitHealth(false)
+	status.Store(http.StatusOK)
+	waitHealth(true)
+}
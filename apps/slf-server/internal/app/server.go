@@ -11,21 +11,44 @@ type Server struct {
 	cfg      *config.Config
 	manager  *session.Manager
 	consumer *kafka.KafkaConsumer
+	producer *kafka.EventProducer
 }
 
 func NewServer(cfg *config.Config) *Server {
 	reg := session.NewRegistry()
-	manager := session.NewManager(reg)
+	forwardAllow, err := session.NewDialAllowlist(cfg.ForwardAllow)
+	if err != nil {
+		log.Fatalf("invalid FORWARD_DIAL_ALLOW: %v", err)
+	}
+	if cfg.ForwardDial && len(cfg.ForwardAllow) == 0 {
+		log.Println("[app] FORWARD_DIAL is on but FORWARD_DIAL_ALLOW is empty, direct forwarding will refuse every address")
+	}
+	producer := kafka.NewEventProducer(cfg.KafkaBrokers, cfg.EventsTopic)
+	manager := session.NewManager(reg, session.ManagerConfig{
+		ProxyProtocol: cfg.ProxyProtocol,
+		ForwardDial:   cfg.ForwardDial,
+		ForwardAllow:  forwardAllow,
+		Timeouts: session.Timeouts{
+			AgentConnect:   session.Duration(cfg.AgentConnectTimeout),
+			AgentWait:      session.Duration(cfg.AgentWaitTimeout),
+			Dial:           session.Duration(cfg.DialTimeout),
+			StreamIdle:     session.Duration(cfg.StreamIdleTimeout),
+			StreamLifetime: session.Duration(cfg.StreamMaxLifetime),
+			SessionIdle:    session.Duration(cfg.SessionIdleTimeout),
+		},
+	}, producer)
 	consumer := kafka.NewKafkaConsumer(cfg.KafkaBrokers, cfg.KafkaTopic, manager)
 
 	return &Server{
 		cfg:      cfg,
 		manager:  manager,
 		consumer: consumer,
+		producer: producer,
 	}
 }
 
 func (s *Server) Start() error {
 	log.Println("[app] starting server...")
+	defer s.producer.Close()
 	return s.consumer.Start()
 }
@@ -3,13 +3,33 @@ package config
 import (
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	KafkaBrokers []string
-	KafkaTopic   string
+	KafkaBrokers  []string
+	KafkaTopic    string
+	EventsTopic   string
+	ProxyProtocol bool     // expect PROXY protocol headers on external listeners
+	ForwardDial   bool     // let forward sessions dial hosts reachable from the server
+	ForwardAllow  []string // CIDRs or addresses forward sessions may dial, none when empty
+
+	// Session timeouts, zero for the built-in defaults. Sessions may
+	// override them in their start message.
+	AgentConnectTimeout time.Duration
+	AgentWaitTimeout    time.Duration
+	DialTimeout         time.Duration
+	StreamIdleTimeout   time.Duration
+	StreamMaxLifetime   time.Duration
+	SessionIdleTimeout  time.Duration
+
+	// Timeouts of the standalone pairing proxy in main.go, zero for its
+	// defaults.
+	PairTimeout     time.Duration
+	PipeReadTimeout time.Duration
 }
 
 func Load() *Config {
@@ -23,7 +43,45 @@ func Load() *Config {
 	}
 
 	return &Config{
-		KafkaBrokers: []string{os.Getenv("KAFKA_URL")},
-		KafkaTopic:   "connection",
+		KafkaBrokers:  []string{os.Getenv("KAFKA_URL")},
+		KafkaTopic:    "connection",
+		EventsTopic:   "connection.events",
+		ProxyProtocol: os.Getenv("PROXY_PROTOCOL") == "true",
+		ForwardDial:   os.Getenv("FORWARD_DIAL") == "true",
+		ForwardAllow:  list("FORWARD_DIAL_ALLOW"),
+
+		AgentConnectTimeout: duration("AGENT_CONNECT_TIMEOUT"),
+		AgentWaitTimeout:    duration("AGENT_WAIT_TIMEOUT"),
+		DialTimeout:         duration("DIAL_TIMEOUT"),
+		StreamIdleTimeout:   duration("STREAM_IDLE_TIMEOUT"),
+		StreamMaxLifetime:   duration("STREAM_MAX_LIFETIME"),
+		SessionIdleTimeout:  duration("SESSION_IDLE_TIMEOUT"),
+
+		PairTimeout:     duration("PAIR_TIMEOUT"),
+		PipeReadTimeout: duration("PIPE_READ_TIMEOUT"),
+	}
+}
+
+// list reads a comma-separated environment variable.
+func list(name string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// duration reads an environment variable like "30s", zero when unset.
+func duration(name string) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Fatalf("invalid %s %q, expected a duration like 30s", name, v)
 	}
+	return d
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"log"
 	"srv/internal/session"
+	"srv/internal/transport/edge"
 
 	kafkago "github.com/segmentio/kafka-go"
 )
@@ -15,11 +16,26 @@ type KafkaConsumer struct {
 }
 
 type SessionMessage struct {
-	Type         string `json:"type"` // start | stop
-	SessionID    string `json:"sessionId"`
-	Address      string `json:"address"`
-	ExternalPort int    `json:"externalPort,omitempty"`
-	InternalPort int    `json:"internalPort,omitempty"`
+	Type         string             `json:"type"` // start | stop
+	SessionID    string             `json:"sessionId"`
+	Address      string             `json:"address"`
+	ExternalPort int                `json:"externalPort,omitempty"`
+	InternalPort int                `json:"internalPort,omitempty"`
+	Mode         string             `json:"mode,omitempty"` // "" | forward | private
+	ShareToken   string             `json:"shareToken,omitempty"`
+	Owner        string             `json:"owner,omitempty"`
+	AgentSecret  string             `json:"agentSecret,omitempty"`
+	Protocol     string             `json:"protocol,omitempty"` // tcp | http | udp
+	Balance      string             `json:"balance,omitempty"`  // round-robin | least-conns | sticky
+	Access       *edge.AccessPolicy `json:"access,omitempty"`
+	Headers      *edge.HeaderRules  `json:"headers,omitempty"`
+	ErrorPages   *edge.ErrorPages   `json:"errorPages,omitempty"`
+	AllowCIDRs   []string           `json:"allowCidrs,omitempty"`
+	DenyCIDRs    []string           `json:"denyCidrs,omitempty"`
+	RateLimit    *session.RateLimit `json:"rateLimit,omitempty"`
+	Bandwidth    *session.Bandwidth `json:"bandwidth,omitempty"`
+	QuotaBytes   int64              `json:"quotaBytes,omitempty"`
+	Timeouts     *session.Timeouts  `json:"timeouts,omitempty"`
 }
 
 func NewKafkaConsumer(brokers []string, topic string, manager *session.Manager) *KafkaConsumer {
@@ -56,7 +72,27 @@ func (kc *KafkaConsumer) Start() error {
 		switch m.Type {
 		case "start":
 			log.Printf("[kafka] starting session: %s", m.SessionID)
-			go kc.manager.StartSession(m.SessionID, m.ExternalPort, m.InternalPort)
+			if err := m.ErrorPages.Validate(); err != nil {
+				log.Printf("[kafka] session %s: dropping custom error pages: %v", m.SessionID, err)
+				m.ErrorPages = nil
+			}
+			go kc.manager.StartSession(m.SessionID, m.ExternalPort, m.InternalPort, session.Options{
+				Mode:        m.Mode,
+				ShareToken:  m.ShareToken,
+				Owner:       m.Owner,
+				AgentSecret: m.AgentSecret,
+				Protocol:    m.Protocol,
+				Balance:     m.Balance,
+				Access:      m.Access,
+				Headers:     m.Headers,
+				ErrorPages:  m.ErrorPages,
+				AllowCIDRs:  m.AllowCIDRs,
+				DenyCIDRs:   m.DenyCIDRs,
+				RateLimit:   m.RateLimit,
+				Bandwidth:   m.Bandwidth,
+				QuotaBytes:  m.QuotaBytes,
+				Timeouts:    m.Timeouts,
+			})
 		case "stop":
 			log.Printf("[kafka] stopping session: %s", m.SessionID)
 			kc.manager.StopSession(m.SessionID)
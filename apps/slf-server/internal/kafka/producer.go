@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"srv/internal/session"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type EventProducer struct {
+	writer *kafkago.Writer
+}
+
+func NewEventProducer(brokers []string, topic string) *EventProducer {
+	return &EventProducer{
+		writer: &kafkago.Writer{
+			Addr:         kafkago.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafkago.Hash{},
+			BatchTimeout: 50 * time.Millisecond,
+		},
+	}
+}
+
+func (p *EventProducer) Publish(ev session.Event) {
+	value, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("[kafka] failed to encode event: %v", err)
+		return
+	}
+
+	err = p.writer.WriteMessages(context.Background(), kafkago.Message{
+		Key:   []byte(ev.SessionID),
+		Value: value,
+	})
+	if err != nil {
+		log.Printf("[kafka] failed to publish %s event for session %s: %v", ev.Type, ev.SessionID, err)
+	}
+}
+
+func (p *EventProducer) Close() error {
+	return p.writer.Close()
+}
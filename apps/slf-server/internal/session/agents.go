@@ -0,0 +1,209 @@
+package session
+
+import (
+	"errors"
+	"hash/fnv"
+	"net"
+	"srv/internal/transport/mux"
+	"sync"
+	"time"
+)
+
+// Policies for spreading external streams across a session's agents.
+const (
+	BalanceRoundRobin = "round-robin"
+	BalanceLeastConns = "least-conns"
+	BalanceSticky     = "sticky" // by source IP
+)
+
+var (
+	ErrNoAgents  = errors.New("no agents connected")
+	ErrUnhealthy = errors.New("local service is unhealthy")
+)
+
+// waitPoll is how often Wait looks for an agent that became available.
+const waitPoll = 100 * time.Millisecond
+
+type agent struct {
+	id  uint64
+	mux *mux.Server
+}
+
+// AgentGroup holds the CLI connections serving one session and picks one
+// of them for every new external stream.
+type AgentGroup struct {
+	policy  string
+	mu      sync.Mutex
+	agents  []*agent
+	nextID  uint64
+	next    int
+	retired [2]uint64 // usage of agents that have left
+}
+
+func NewAgentGroup(policy string) *AgentGroup {
+	return &AgentGroup{policy: policy}
+}
+
+// Add joins a started mux server to the group. It leaves the group on its
+// own once the server stops.
+func (g *AgentGroup) Add(m *mux.Server) {
+	g.mu.Lock()
+	g.nextID++
+	a := &agent{id: g.nextID, mux: m}
+	g.agents = append(g.agents, a)
+	g.mu.Unlock()
+
+	go func() {
+		<-m.Done()
+		g.remove(a)
+	}()
+}
+
+func (g *AgentGroup) remove(a *agent) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, other := range g.agents {
+		if other == a {
+			g.agents = append(g.agents[:i], g.agents[i+1:]...)
+			up, down := a.mux.Usage()
+			g.retired[0] += up
+			g.retired[1] += down
+			return
+		}
+	}
+}
+
+// Len returns the number of connected agents.
+func (g *AgentGroup) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.agents)
+}
+
+// Pick returns the agent for a stream from addr, or nil when no agent with
+// a healthy local service is connected. addr may be nil for streams
+// without a client address.
+func (g *AgentGroup) Pick(addr net.Addr) *mux.Server {
+	m, _ := g.pick(addr)
+	return m
+}
+
+// Wait is Pick, holding the stream up to hold for an agent to connect or
+// for its local service to recover. It returns ErrNoAgents or ErrUnhealthy
+// when none does.
+func (g *AgentGroup) Wait(addr net.Addr, hold time.Duration) (*mux.Server, error) {
+	deadline := time.Now().Add(hold)
+	for {
+		m, err := g.pick(addr)
+		if err == nil || !time.Now().Before(deadline) {
+			return m, err
+		}
+		time.Sleep(waitPoll)
+	}
+}
+
+func (g *AgentGroup) pick(addr net.Addr) (*mux.Server, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var live []*agent
+	connected := false
+	for _, a := range g.agents {
+		select {
+		case <-a.mux.Done():
+		default:
+			connected = true
+			if a.mux.Healthy() {
+				live = append(live, a)
+			}
+		}
+	}
+	if len(live) == 0 {
+		if connected {
+			return nil, ErrUnhealthy
+		}
+		return nil, ErrNoAgents
+	}
+
+	switch g.policy {
+	case BalanceLeastConns:
+		best := live[0]
+		for _, a := range live[1:] {
+			if a.mux.Streams() < best.mux.Streams() {
+				best = a
+			}
+		}
+		return best.mux, nil
+	case BalanceSticky:
+		if ip := addrIP(addr); ip.IsValid() {
+			return rendezvous(live, ip.String()).mux, nil
+		}
+	}
+
+	g.next++
+	return live[g.next%len(live)].mux, nil
+}
+
+// rendezvous picks the agent with the highest hash for key, so a source
+// keeps its agent for as long as that agent stays connected.
+func rendezvous(agents []*agent, key string) *agent {
+	var best *agent
+	var bestScore uint64
+	for _, a := range agents {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		var id [8]byte
+		for i := range id {
+			id[i] = byte(a.id >> (8 * i))
+		}
+		h.Write(id[:])
+		if score := h.Sum64(); best == nil || score > bestScore {
+			best, bestScore = a, score
+		}
+	}
+	return best
+}
+
+// Open opens a stream to one of the agents, waiting up to hold for one as
+// Wait does.
+func (g *AgentGroup) Open(hold time.Duration) (net.Conn, error) {
+	m, err := g.Wait(nil, hold)
+	if err != nil {
+		return nil, err
+	}
+	return m.OpenStream()
+}
+
+// Usage returns the bytes carried by all agents, past and present.
+func (g *AgentGroup) Usage() (up, down uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	up, down = g.retired[0], g.retired[1]
+	for _, a := range g.agents {
+		u, d := a.mux.Usage()
+		up += u
+		down += d
+	}
+	return up, down
+}
+
+// Streams returns the number of streams open on all agents.
+func (g *AgentGroup) Streams() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n := 0
+	for _, a := range g.agents {
+		n += a.mux.Streams()
+	}
+	return n
+}
+
+// Stop disconnects every agent.
+func (g *AgentGroup) Stop() {
+	g.mu.Lock()
+	agents := append([]*agent(nil), g.agents...)
+	g.mu.Unlock()
+	for _, a := range agents {
+		a.mux.Stop()
+	}
+}
@@ -0,0 +1,129 @@
+package session_test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"srv/internal/session"
+	"srv/internal/transport/frame"
+	"srv/internal/transport/mux"
+)
+
+// newAgent starts a mux server whose internal client discards every frame.
+func newAgent(t *testing.T) *mux.Server {
+	internal, client := net.Pipe()
+	go io.Copy(io.Discard, client)
+	m := mux.NewServer(internal)
+	m.Start()
+	t.Cleanup(m.Stop)
+	return m
+}
+
+// reportHealth sends a HEALTH frame from an agent's internal client and
+// waits for the server to apply it.
+func reportHealth(t *testing.T, m *mux.Server, client net.Conn, healthy bool) {
+	t.Helper()
+	payload := frame.EncodeHealth(frame.HealthMeta{Healthy: healthy, Detail: "connection refused"})
+	err := frame.WriteFrame(client, &frame.Frame{Type: frame.TypeHealth, Length: uint32(len(payload)), Payload: payload})
+	if err != nil {
+		t.Fatalf("failed to write HEALTH frame: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for m.Healthy() != healthy && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAgentGroupRoundRobin(t *testing.T) {
+	g := session.NewAgentGroup(session.BalanceRoundRobin)
+	a, b := newAgent(t), newAgent(t)
+	g.Add(a)
+	g.Add(b)
+
+	first, second, third := g.Pick(nil), g.Pick(nil), g.Pick(nil)
+	if first == second || first != third {
+		t.Fatal("expected picks to alternate between agents")
+	}
+}
+
+func TestAgentGroupLeastConns(t *testing.T) {
+	g := session.NewAgentGroup(session.BalanceLeastConns)
+	a, b := newAgent(t), newAgent(t)
+	g.Add(a)
+	g.Add(b)
+
+	if _, err := a.OpenStream(); err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for a.Streams() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for i := 0; i < 3; i++ {
+		if g.Pick(nil) != b {
+			t.Fatal("expected the idle agent to be picked")
+		}
+	}
+}
+
+func TestAgentGroupStickyFailover(t *testing.T) {
+	g := session.NewAgentGroup(session.BalanceSticky)
+	a, b := newAgent(t), newAgent(t)
+	g.Add(a)
+	g.Add(b)
+
+	client := tcpAddr("203.0.113.7:1000")
+	picked := g.Pick(client)
+	for i := 0; i < 5; i++ {
+		if g.Pick(tcpAddr("203.0.113.7:2000")) != picked {
+			t.Fatal("expected the same agent for the same source IP")
+		}
+	}
+
+	picked.Stop()
+	other := g.Pick(client)
+	if other == nil || other == picked {
+		t.Fatal("expected failover to the remaining agent")
+	}
+
+	other.Stop()
+	if g.Pick(client) != nil {
+		t.Fatal("expected no agent once all have stopped")
+	}
+}
+
+func TestAgentGroupSkipsUnhealthyAgents(t *testing.T) {
+	g := session.NewAgentGroup(session.BalanceRoundRobin)
+	internal, client := net.Pipe()
+	go io.Copy(io.Discard, client)
+	sick := mux.NewServer(internal)
+	sick.Start()
+	t.Cleanup(sick.Stop)
+	healthy := newAgent(t)
+	g.Add(sick)
+	g.Add(healthy)
+
+	reportHealth(t, sick, client, false)
+	for i := 0; i < 3; i++ {
+		if g.Pick(nil) != healthy {
+			t.Fatal("expected only the healthy agent to be picked")
+		}
+	}
+
+	healthy.Stop()
+	if _, err := g.Wait(nil, 50*time.Millisecond); err != session.ErrUnhealthy {
+		t.Fatalf("expected ErrUnhealthy, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		payload := frame.EncodeHealth(frame.HealthMeta{Healthy: true})
+		frame.WriteFrame(client, &frame.Frame{Type: frame.TypeHealth, Length: uint32(len(payload)), Payload: payload})
+	}()
+	if m, err := g.Wait(nil, 2*time.Second); err != nil || m != sick {
+		t.Fatalf("expected the recovered agent while holding, got %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package session
+
+import "time"
+
+const (
+	EventUsage         = "usage"
+	EventQuotaExceeded = "quota_exceeded"
+	EventExpired       = "expired" // stopped by a connect or idle timeout
+)
+
+// Event reports session activity back to the backend.
+type Event struct {
+	Type      string    `json:"type"`
+	SessionID string    `json:"sessionId"`
+	BytesUp   uint64    `json:"bytesUp"`
+	BytesDown uint64    `json:"bytesDown"`
+	Time      time.Time `json:"time"`
+}
+
+type EventSink interface {
+	Publish(ev Event)
+}
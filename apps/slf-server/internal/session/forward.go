@@ -0,0 +1,94 @@
+package session
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"srv/internal/transport/edge"
+)
+
+var ErrPeerDenied = errors.New("not allowed to reach this session")
+
+// AuthorizePeer decides whether a forward session owned by owner, presenting
+// shareToken, may open streams to s. Sessions of the same owner may reach
+// each other; sessions issued a share token also admit whoever presents it.
+func (s *Session) AuthorizePeer(owner, shareToken string) error {
+	if s.Options.Mode == ModeForward {
+		return fmt.Errorf("session %s does not expose a service", s.ID)
+	}
+	if owner != "" && subtle.ConstantTimeCompare([]byte(owner), []byte(s.Options.Owner)) == 1 {
+		return nil
+	}
+	// Only sessions issued a share token opted in to peers of other owners;
+	// an empty token must never match an empty one.
+	if s.Options.ShareToken != "" && shareToken != "" &&
+		subtle.ConstantTimeCompare([]byte(shareToken), []byte(s.Options.ShareToken)) == 1 {
+		return nil
+	}
+	return fmt.Errorf("session %s: %w", s.ID, ErrPeerDenied)
+}
+
+// DialAllowlist limits the networks forward sessions may dial directly
+// from the server. An empty list allows nothing.
+type DialAllowlist struct {
+	prefixes []netip.Prefix
+}
+
+func NewDialAllowlist(cidrs []string) (*DialAllowlist, error) {
+	prefixes, err := edge.ParsePrefixes(cidrs)
+	if err != nil {
+		return nil, err
+	}
+	return &DialAllowlist{prefixes: prefixes}, nil
+}
+
+func (l *DialAllowlist) allowed(ip netip.Addr) bool {
+	if l == nil {
+		return false
+	}
+	for _, p := range l.prefixes {
+		if p.Contains(ip.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dial resolves target once and connects to its first allowed address, so
+// a name cannot resolve to an allowed address for the check and another
+// one for the dial.
+func (l *DialAllowlist) Dial(target string, timeout time.Duration) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if l.allowed(ip) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", net.JoinHostPort(ip.Unmap().String(), port))
+		}
+	}
+	return nil, fmt.Errorf("%s is not in the forward dial allowlist", target)
+}
+
+// peerConn reports the forward session's address as the remote end of an
+// in-memory stream, so session policies and X-Forwarded-For see it.
+type peerConn struct {
+	net.Conn
+	peer net.Addr
+}
+
+func (c *peerConn) RemoteAddr() net.Addr {
+	return c.peer
+}
@@ -0,0 +1,87 @@
+package session_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"srv/internal/session"
+)
+
+func TestAuthorizePeer(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  session.Options
+		owner   string
+		token   string
+		allowed bool
+	}{
+		{"same owner", session.Options{Owner: "key-a"}, "key-a", "", true},
+		{"other owner public", session.Options{Owner: "key-a"}, "key-b", "", false},
+		{"no owner", session.Options{}, "", "", false},
+		{"private with token", session.Options{Mode: session.ModePrivate, Owner: "key-a", ShareToken: "secret"}, "key-b", "secret", true},
+		{"private wrong token", session.Options{Mode: session.ModePrivate, Owner: "key-a", ShareToken: "secret"}, "key-b", "nope", false},
+		{"private without token", session.Options{Mode: session.ModePrivate, Owner: "key-a"}, "key-b", "", false},
+		{"public ignores token", session.Options{Owner: "key-a"}, "key-b", "secret", false},
+		{"forward target", session.Options{Mode: session.ModeForward, Owner: "key-a"}, "key-a", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &session.Session{ID: "target", Options: tt.target}
+			err := s.AuthorizePeer(tt.owner, tt.token)
+			if tt.allowed && err != nil {
+				t.Fatalf("expected access, got %v", err)
+			}
+			if !tt.allowed && err == nil {
+				t.Fatal("expected refusal")
+			}
+		})
+	}
+
+	s := &session.Session{ID: "target", Options: session.Options{Owner: "key-a"}}
+	if err := s.AuthorizePeer("key-b", ""); !errors.Is(err, session.ErrPeerDenied) {
+		t.Fatalf("expected ErrPeerDenied, got %v", err)
+	}
+}
+
+func TestDialAllowlist(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	empty, err := session.NewDialAllowlist(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := empty.Dial(ln.Addr().String(), time.Second); err == nil {
+		t.Fatal("empty allowlist dialed")
+	}
+
+	other, _ := session.NewDialAllowlist([]string{"10.0.0.0/8"})
+	if _, err := other.Dial(ln.Addr().String(), time.Second); err == nil {
+		t.Fatal("dialed an address outside the allowlist")
+	}
+
+	loopback, _ := session.NewDialAllowlist([]string{"127.0.0.0/8"})
+	conn, err := loopback.Dial(ln.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("expected dial within the allowlist, got %v", err)
+	}
+	conn.Close()
+
+	if _, err := session.NewDialAllowlist([]string{"not-a-cidr"}); err == nil {
+		t.Fatal("expected invalid CIDR error")
+	}
+}
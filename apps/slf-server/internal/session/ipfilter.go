@@ -0,0 +1,52 @@
+package session
+
+import (
+	"net"
+	"net/netip"
+
+	"srv/internal/transport/edge"
+)
+
+// IPFilter decides which external addresses may connect to a session.
+// Deny entries win; a non-empty allow list admits only matching addresses.
+type IPFilter struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+func NewIPFilter(allow, deny []string) (*IPFilter, error) {
+	f := &IPFilter{}
+	var err error
+	if f.allow, err = edge.ParsePrefixes(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = edge.ParsePrefixes(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *IPFilter) Allowed(addr net.Addr) bool {
+	if f == nil || (len(f.allow) == 0 && len(f.deny) == 0) {
+		return true
+	}
+	ip := addrIP(addr)
+	if !ip.IsValid() {
+		return false
+	}
+
+	for _, p := range f.deny {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, p := range f.allow {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package session_test
+
+import (
+	"net"
+	"testing"
+
+	"srv/internal/session"
+)
+
+func TestIPFilterAllowed(t *testing.T) {
+	f, err := session.NewIPFilter([]string{"10.0.0.0/8", "203.0.113.7"}, []string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatalf("NewIPFilter failed: %v", err)
+	}
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"10.2.3.4:1000", true},
+		{"10.1.2.3:1000", false},
+		{"203.0.113.7:1000", true},
+		{"203.0.113.8:1000", false},
+		{"[::ffff:10.2.3.4]:1000", true},
+	}
+
+	for _, tt := range tests {
+		addr, _ := net.ResolveTCPAddr("tcp", tt.addr)
+		if got := f.Allowed(addr); got != tt.want {
+			t.Errorf("Allowed(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestIPFilterDenyOnly(t *testing.T) {
+	f, err := session.NewIPFilter(nil, []string{"192.0.2.0/24"})
+	if err != nil {
+		t.Fatalf("NewIPFilter failed: %v", err)
+	}
+
+	blocked, _ := net.ResolveTCPAddr("tcp", "192.0.2.10:80")
+	other, _ := net.ResolveTCPAddr("tcp", "198.51.100.1:80")
+	if f.Allowed(blocked) {
+		t.Error("expected denied address to be rejected")
+	}
+	if !f.Allowed(other) {
+		t.Error("expected other address to be allowed")
+	}
+}
+
+func TestIPFilterInvalidCIDR(t *testing.T) {
+	if _, err := session.NewIPFilter([]string{"10.0.0.0/33"}, nil); err == nil {
+		t.Fatal("expected error for invalid CIDR")
+	}
+}
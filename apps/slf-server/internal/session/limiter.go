@@ -0,0 +1,147 @@
+package session
+
+import (
+	"math"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// RateLimit caps how fast and how many external connections a session
+// accepts. Zero values disable the corresponding limit.
+type RateLimit struct {
+	ConnsPerSecond      float64 `json:"connsPerSecond,omitempty"`
+	Burst               int     `json:"burst,omitempty"`
+	PerIPConnsPerSecond float64 `json:"perIpConnsPerSecond,omitempty"`
+	PerIPBurst          int     `json:"perIpBurst,omitempty"`
+	MaxConns            int     `json:"maxConns,omitempty"`
+}
+
+const idleBucketTTL = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned since the last refill and reports whether
+// one is available. Callers take it by decrementing tokens.
+func (b *bucket) refill(rate float64, burst int, now time.Time) bool {
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	return b.tokens >= 1
+}
+
+// ConnLimiter admits external connections according to a RateLimit.
+type ConnLimiter struct {
+	cfg     RateLimit
+	mu      sync.Mutex
+	session bucket
+	perIP   map[netip.Addr]*bucket
+	swept   time.Time
+	active  int
+}
+
+func NewConnLimiter(cfg *RateLimit) *ConnLimiter {
+	if cfg == nil {
+		return nil
+	}
+
+	l := &ConnLimiter{cfg: *cfg, perIP: make(map[netip.Addr]*bucket)}
+	if l.cfg.Burst <= 0 {
+		l.cfg.Burst = int(math.Max(1, math.Ceil(l.cfg.ConnsPerSecond)))
+	}
+	if l.cfg.PerIPBurst <= 0 {
+		l.cfg.PerIPBurst = int(math.Max(1, math.Ceil(l.cfg.PerIPConnsPerSecond)))
+	}
+	l.session = bucket{tokens: float64(l.cfg.Burst), last: time.Now()}
+	return l
+}
+
+// Acquire reserves a slot for a connection from addr. On success the
+// returned release func must be called once the connection is closed.
+// Tokens are only taken when every limit admits the connection, so a
+// rejection by one limit does not use up another.
+func (l *ConnLimiter) Acquire(addr net.Addr) (release func(), reason string) {
+	if l == nil {
+		return func() {}, ""
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+
+	if l.cfg.MaxConns > 0 && l.active >= l.cfg.MaxConns {
+		return nil, "max connections reached"
+	}
+
+	if l.cfg.ConnsPerSecond > 0 && !l.session.refill(l.cfg.ConnsPerSecond, l.cfg.Burst, now) {
+		return nil, "session rate limit exceeded"
+	}
+
+	var ipBucket *bucket
+	if l.cfg.PerIPConnsPerSecond > 0 {
+		ip := addrIP(addr)
+		ipBucket = l.perIP[ip]
+		if ipBucket == nil {
+			ipBucket = &bucket{tokens: float64(l.cfg.PerIPBurst), last: now}
+			l.perIP[ip] = ipBucket
+		}
+		l.sweep(now)
+		if !ipBucket.refill(l.cfg.PerIPConnsPerSecond, l.cfg.PerIPBurst, now) {
+			return nil, "per-IP rate limit exceeded"
+		}
+	}
+
+	if l.cfg.ConnsPerSecond > 0 {
+		l.session.tokens--
+	}
+	if ipBucket != nil {
+		ipBucket.tokens--
+	}
+	l.active++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.active--
+			l.mu.Unlock()
+		})
+	}, ""
+}
+
+// sweep drops per-IP buckets that have been idle long enough to be full again.
+func (l *ConnLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < idleBucketTTL {
+		return
+	}
+	l.swept = now
+	for ip, b := range l.perIP {
+		if now.Sub(b.last) > idleBucketTTL {
+			delete(l.perIP, ip)
+		}
+	}
+}
+
+func addrIP(addr net.Addr) netip.Addr {
+	if addr == nil {
+		return netip.Addr{}
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ap.Addr().Unmap()
+}
+
+// limitedConn releases its limiter slot when closed.
+type limitedConn struct {
+	net.Conn
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	c.release()
+	return c.Conn.Close()
+}
@@ -0,0 +1,117 @@
+package session_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"srv/internal/session"
+)
+
+func tcpAddr(s string) net.Addr {
+	addr, _ := net.ResolveTCPAddr("tcp", s)
+	return addr
+}
+
+func TestConnLimiterMaxConns(t *testing.T) {
+	l := session.NewConnLimiter(&session.RateLimit{MaxConns: 2})
+
+	r1, _ := l.Acquire(tcpAddr("10.0.0.1:1"))
+	r2, _ := l.Acquire(tcpAddr("10.0.0.2:1"))
+	if r1 == nil || r2 == nil {
+		t.Fatal("expected first two connections to be admitted")
+	}
+
+	if r3, reason := l.Acquire(tcpAddr("10.0.0.3:1")); r3 != nil || reason == "" {
+		t.Fatal("expected third connection to be rejected")
+	}
+
+	r1()
+	r1() // releasing twice must not free a second slot
+	if r4, _ := l.Acquire(tcpAddr("10.0.0.4:1")); r4 == nil {
+		t.Fatal("expected a slot after release")
+	}
+	if r5, _ := l.Acquire(tcpAddr("10.0.0.5:1")); r5 != nil {
+		t.Fatal("expected limiter to be full again")
+	}
+}
+
+func TestConnLimiterPerIP(t *testing.T) {
+	l := session.NewConnLimiter(&session.RateLimit{PerIPConnsPerSecond: 0.001, PerIPBurst: 2})
+
+	for i := 0; i < 2; i++ {
+		if r, _ := l.Acquire(tcpAddr("203.0.113.7:1000")); r == nil {
+			t.Fatalf("expected connection %d within burst to be admitted", i)
+		}
+	}
+	if r, _ := l.Acquire(tcpAddr("203.0.113.7:1001")); r != nil {
+		t.Fatal("expected connection over burst to be rejected")
+	}
+	if r, _ := l.Acquire(tcpAddr("203.0.113.8:1000")); r == nil {
+		t.Fatal("expected another source IP to be admitted")
+	}
+}
+
+func TestConnLimiterSessionRate(t *testing.T) {
+	l := session.NewConnLimiter(&session.RateLimit{ConnsPerSecond: 0.001, Burst: 1})
+
+	if r, _ := l.Acquire(tcpAddr("10.0.0.1:1")); r == nil {
+		t.Fatal("expected first connection to be admitted")
+	}
+	if r, _ := l.Acquire(tcpAddr("10.0.0.2:1")); r != nil {
+		t.Fatal("expected second connection to exceed the session rate")
+	}
+}
+
+func TestConnLimiterMaxConnsRejectionKeepsPerIPToken(t *testing.T) {
+	l := session.NewConnLimiter(&session.RateLimit{PerIPConnsPerSecond: 0.001, PerIPBurst: 1, MaxConns: 1})
+
+	release, _ := l.Acquire(tcpAddr("10.0.0.1:1"))
+	if release == nil {
+		t.Fatal("expected first connection to be admitted")
+	}
+	if r, reason := l.Acquire(tcpAddr("203.0.113.7:1")); r != nil || reason != "max connections reached" {
+		t.Fatalf("expected max conns to reject, got %q", reason)
+	}
+	release()
+	if r, reason := l.Acquire(tcpAddr("203.0.113.7:2")); r == nil {
+		t.Fatalf("expected the per-IP token to be unspent, got %q", reason)
+	}
+}
+
+func TestConnLimiterSessionRejectionKeepsPerIPToken(t *testing.T) {
+	l := session.NewConnLimiter(&session.RateLimit{
+		ConnsPerSecond: 10, Burst: 1,
+		PerIPConnsPerSecond: 0.001, PerIPBurst: 1,
+	})
+
+	if r, _ := l.Acquire(tcpAddr("10.0.0.1:1")); r == nil {
+		t.Fatal("expected first connection to be admitted")
+	}
+	if r, reason := l.Acquire(tcpAddr("203.0.113.7:1")); r != nil || reason != "session rate limit exceeded" {
+		t.Fatalf("expected the session bucket to reject, got %q", reason)
+	}
+
+	// the session bucket refills within 100ms, the per-IP one never
+	deadline := time.Now().Add(time.Second)
+	for {
+		r, reason := l.Acquire(tcpAddr("203.0.113.7:2"))
+		if r != nil {
+			break
+		}
+		if reason == "per-IP rate limit exceeded" {
+			t.Fatal("per-IP token was spent by a connection the session bucket rejected")
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("connection still rejected: %q", reason)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConnLimiterNil(t *testing.T) {
+	var l *session.ConnLimiter
+	if r, _ := l.Acquire(nil); r == nil {
+		t.Fatal("nil limiter should admit every connection")
+	}
+}
@@ -1,24 +1,66 @@
 package session
 
 import (
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"srv/internal/transport/edge"
+	"srv/internal/transport/frame"
 	"srv/internal/transport/mux"
+	"srv/internal/transport/proxyproto"
+	"srv/internal/transport/shaper"
+	"strconv"
+	"time"
 )
 
+const (
+	proxyHeaderTimeout = 5 * time.Second
+	helloTimeout       = 10 * time.Second
+	maxHelloSize       = 4096
+	usageInterval      = 30 * time.Second
+	udpIdleTimeout     = 2 * time.Minute
+)
+
+// ManagerConfig holds the server-wide settings applied to every session.
+type ManagerConfig struct {
+	ProxyProtocol bool
+	ForwardDial   bool // let forward sessions reach hosts from the server's network
+	ForwardAllow  *DialAllowlist
+	Timeouts      Timeouts
+}
+
 type Manager struct {
 	registry *Registry
+	cfg      ManagerConfig
+	events   EventSink
 }
 
-func NewManager(r *Registry) *Manager {
-	return &Manager{registry: r}
+// NewManager creates a session manager. events may be nil when nothing
+// consumes session usage reports.
+func NewManager(r *Registry, cfg ManagerConfig, events EventSink) *Manager {
+	return &Manager{registry: r, cfg: cfg, events: events}
 }
 
-func (m *Manager) StartSession(id string, extPort, intPort int) {
-	if existing, exists := m.registry.Get(id); exists {
-		log.Printf("[session] session %s already exists, waiting for internal reconnect", id)
-		go existing.WaitForInternalReconnect()
+func (m *Manager) StartSession(id string, extPort, intPort int, opts Options) {
+	if _, exists := m.registry.Get(id); exists {
+		log.Printf("[session] session %s already exists, agents join on its internal port", id)
+		return
+	}
+
+	if opts.AgentSecret == "" {
+		log.Printf("[session] refusing session %s: no agent secret", id)
+		return
+	}
+
+	ipFilter, err := NewIPFilter(opts.AllowCIDRs, opts.DenyCIDRs)
+	if err != nil {
+		log.Printf("[session] refusing session %s: %v", id, err)
+		return
+	}
+	if err := opts.Access.Compile(); err != nil {
+		log.Printf("[session] refusing session %s: %v", id, err)
 		return
 	}
 
@@ -27,24 +69,84 @@ func (m *Manager) StartSession(id string, extPort, intPort int) {
 		log.Printf("[session] failed to listen on internal port %d: %v", intPort, err)
 		return
 	}
-	log.Printf("[session] waiting for internal client on :%d...", intPort)
+	timeouts := m.cfg.Timeouts.Merge(opts.Timeouts).WithDefaults()
+	log.Printf("[session] waiting up to %s for internal client on :%d...", time.Duration(timeouts.AgentConnect), intPort)
 
-	internalConn, err := internalLn.Accept()
+	internalConn, err := acceptAgent(internalLn, time.Duration(timeouts.AgentConnect), opts.AgentSecret)
 	if err != nil {
 		log.Printf("[session] failed to accept internal connection: %v", err)
 		internalLn.Close()
+		if m.events != nil {
+			m.events.Publish(Event{Type: EventExpired, SessionID: id, Time: time.Now()})
+		}
 		return
 	}
-	internalLn.Close()
 	log.Printf("[session] internal client connected")
 
-	muxServer := mux.NewServer(internalConn)
-	muxServer.Start()
-
-	externalLn, err := net.Listen("tcp", fmt.Sprintf(":%d", extPort))
+	var externalLn net.Listener
+	var externalPC net.PacketConn
+	if !opts.Exposed() {
+		// forward and private sessions have no external port
+	} else if opts.Protocol == ProtocolUDP {
+		externalPC, err = net.ListenPacket("udp", fmt.Sprintf(":%d", extPort))
+	} else {
+		externalLn, err = net.Listen("tcp", fmt.Sprintf(":%d", extPort))
+	}
 	if err != nil {
 		log.Printf("[session] failed to listen on external port %d: %v", extPort, err)
 		internalConn.Close()
+		internalLn.Close()
+		return
+	}
+
+	s := &Session{
+		ID:           id,
+		ExternalPort: extPort,
+		InternalPort: intPort,
+		ExtListener:  externalLn,
+		ExtPacket:    externalPC,
+		IntListener:  internalLn,
+		Active:       true,
+		Options:      opts,
+		timeouts:     timeouts,
+		ipFilter:     ipFilter,
+		limiter:      NewConnLimiter(opts.RateLimit),
+		agents:       NewAgentGroup(opts.Balance),
+		quit:         make(chan struct{}),
+	}
+	if opts.Bandwidth != nil {
+		s.up = shaper.NewLimiter(opts.Bandwidth.UpBytesPerSec)
+		s.down = shaper.NewLimiter(opts.Bandwidth.DownBytesPerSec)
+	}
+	first := m.addAgent(s, internalConn)
+
+	if opts.IsHTTP() {
+		s.edgeServer = edge.NewServer(edge.Config{
+			Access:     opts.Access,
+			Headers:    opts.Headers,
+			ErrorPages: opts.ErrorPages,
+			// a stream without traffic is closed after StreamIdle anyway
+			ResponseTimeout: time.Duration(timeouts.StreamIdle),
+			StreamIdle:      time.Duration(timeouts.StreamIdle),
+		}, func() (net.Conn, error) {
+			conn, err := s.agents.Open(time.Duration(timeouts.AgentWait))
+			return conn, edgeError(err)
+		})
+		s.edgeServer.Start()
+	}
+
+	m.registry.Add(s)
+	go m.monitor(s)
+	go m.acceptAgents(s)
+
+	if !opts.Exposed() {
+		log.Printf("[session] started %s session %s", opts.Mode, id)
+		return
+	}
+
+	if externalPC != nil {
+		go m.serveUDP(s, first, externalPC)
+		log.Printf("[session] started udp session %s", id)
 		return
 	}
 
@@ -55,22 +157,295 @@ func (m *Manager) StartSession(id string, extPort, intPort int) {
 				log.Printf("[session] external accept error: %v", err)
 				break
 			}
-			log.Printf("[session] accepted external: %s", conn.RemoteAddr())
-			muxServer.AddExternalConn(conn)
+			go m.handleExternal(s, conn)
 		}
 	}()
 
-	s := &Session{
-		ID:           id,
-		ExternalPort: extPort,
-		InternalPort: intPort,
-		ExtListener:  externalLn,
-		Active:       true,
-		muxServer:    muxServer,
+	log.Printf("[session] started session %s", id)
+}
+
+// acceptAgents lets further CLI connections join the session, either as
+// extra agents or to replace one that dropped.
+func (m *Manager) acceptAgents(s *Session) {
+	for {
+		conn, err := s.IntListener.Accept()
+		if err != nil {
+			log.Printf("[session] %s: internal accept stopped: %v", s.ID, err)
+			return
+		}
+		go func() {
+			if err := readHello(conn, s.Options.AgentSecret); err != nil {
+				log.Printf("[session] %s: refused agent %s: %v", s.ID, conn.RemoteAddr(), err)
+				conn.Close()
+				return
+			}
+			m.addAgent(s, conn)
+			log.Printf("[session] %s: agent joined, %d connected", s.ID, s.agents.Len())
+		}()
 	}
-	m.registry.Add(s)
+}
 
-	log.Printf("[session] started session %s", id)
+func (m *Manager) addAgent(s *Session, conn net.Conn) *mux.Server {
+	agent := mux.NewServer(conn)
+	agent.SetLimiters(s.up, s.down)
+	agent.SetTimeouts(time.Duration(s.timeouts.StreamIdle), time.Duration(s.timeouts.StreamLifetime))
+	if s.Options.Mode == ModeForward {
+		peer := conn.RemoteAddr()
+		agent.SetDialer(func(open frame.OpenMeta) (net.Conn, error) {
+			return m.dialForward(s, peer, open)
+		})
+	}
+	agent.Start()
+	s.agents.Add(agent)
+	return agent
+}
+
+func (m *Manager) handleExternal(s *Session, conn net.Conn) {
+	if m.cfg.ProxyProtocol {
+		pc, err := proxyproto.Read(conn, proxyHeaderTimeout)
+		if err != nil {
+			log.Printf("[session] rejected external %s: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			return
+		}
+		conn = pc
+	}
+
+	release, ok := m.admit(s, conn.RemoteAddr())
+	if !ok {
+		conn.Close()
+		return
+	}
+	conn = &limitedConn{Conn: conn, release: release}
+
+	log.Printf("[session] accepted external: %s", conn.RemoteAddr())
+	if s.edgeServer != nil {
+		s.edgeServer.ServeConn(conn)
+		return
+	}
+	agent, err := s.agents.Wait(conn.RemoteAddr(), time.Duration(s.timeouts.AgentWait))
+	if err != nil {
+		m.reject(s, conn.RemoteAddr(), err.Error())
+		conn.Close()
+		return
+	}
+	if err := agent.AddExternalConn(conn); err != nil {
+		m.reject(s, conn.RemoteAddr(), err.Error())
+		conn.Close()
+	}
+}
+
+// admit applies the session's IP policy and connection limits to a new
+// external peer. On success release must be called when the peer is gone.
+func (m *Manager) admit(s *Session, addr net.Addr) (release func(), ok bool) {
+	if !s.ipFilter.Allowed(addr) {
+		m.reject(s, addr, "IP policy")
+		return nil, false
+	}
+
+	release, reason := s.limiter.Acquire(addr)
+	if release == nil {
+		m.reject(s, addr, reason)
+		return nil, false
+	}
+	return release, true
+}
+
+// dialForward connects a stream opened by the forward session from. Targets
+// of the form "<session>" reach that session's service and
+// "<session>:<port>" another port on its CLI host, when AuthorizePeer lets
+// from in; the stream then goes through the target's IP policy, limits and
+// edge server like an external connection from peer. Anything else is
+// dialed from the server when ForwardDial is enabled and the address is in
+// the allowlist.
+func (m *Manager) dialForward(from *Session, peer net.Addr, open frame.OpenMeta) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(open.Target)
+	if err != nil {
+		host, portStr = open.Target, ""
+	}
+
+	if s, ok := m.registry.Get(host); ok {
+		port := 0
+		if portStr != "" {
+			port, err = strconv.Atoi(portStr)
+			if err != nil || port <= 0 || port > 65535 {
+				return nil, fmt.Errorf("invalid port %q", portStr)
+			}
+		}
+		if err := s.AuthorizePeer(from.Options.Owner, open.ShareToken); err != nil {
+			log.Printf("[session] %s: refused forward from %s: %v", s.ID, from.ID, err)
+			return nil, err
+		}
+		release, ok := m.admit(s, peer)
+		if !ok {
+			return nil, fmt.Errorf("session %s refused the connection", host)
+		}
+
+		if port == 0 && s.edgeServer != nil {
+			local, remote := net.Pipe()
+			s.edgeServer.ServeConn(&limitedConn{Conn: &peerConn{Conn: remote, peer: peer}, release: release})
+			return local, nil
+		}
+		agent, err := s.agents.Wait(peer, time.Duration(s.timeouts.AgentWait))
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("session %s: %w", host, err)
+		}
+		conn, err := agent.OpenStreamWith(frame.ConnectMeta{TargetPort: port, RemoteAddr: peer.String()})
+		if err != nil {
+			release()
+			return nil, err
+		}
+		return &limitedConn{Conn: conn, release: release}, nil
+	}
+
+	if portStr == "" {
+		return nil, fmt.Errorf("unknown session %s", host)
+	}
+	if !m.cfg.ForwardDial {
+		return nil, fmt.Errorf("unknown session %s and direct forwarding is disabled", host)
+	}
+	return m.cfg.ForwardAllow.Dial(open.Target, time.Duration(from.timeouts.Dial))
+}
+
+// edgeError maps the errors of opening a stream to the ones the edge
+// server shows error pages for.
+func edgeError(err error) error {
+	switch {
+	case errors.Is(err, ErrNoAgents):
+		return fmt.Errorf("%w: %w", edge.ErrOffline, err)
+	case errors.Is(err, ErrUnhealthy):
+		return fmt.Errorf("%w: %w", edge.ErrUnavailable, err)
+	}
+	return err
+}
+
+func (m *Manager) reject(s *Session, addr net.Addr, reason string) {
+	n := s.Rejected.Add(1)
+	log.Printf("[session] %s: rejected external %s: %s (%d rejected)", s.ID, addr, reason, n)
+}
+
+// serveUDP relays the session's datagrams through one agent at a time.
+// Datagram streams live on a single agent, so when it drops, its streams
+// end and the socket moves on to another agent.
+func (m *Manager) serveUDP(s *Session, agent *mux.Server, pc net.PacketConn) {
+	admit := func(addr net.Addr) (func(), bool) {
+		return m.admit(s, addr)
+	}
+	for {
+		if err := agent.ServeUDP(pc, udpIdleTimeout, admit); err != nil {
+			return
+		}
+		for {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			next, err := s.agents.Wait(nil, max(time.Duration(s.timeouts.AgentWait), time.Second))
+			if err == nil {
+				agent = next
+				log.Printf("[session] %s: udp moved to another agent", s.ID)
+				break
+			}
+		}
+	}
+}
+
+// acceptAgent accepts the session's first agent, giving up after timeout
+// unless it is zero. Connections without a valid HELLO are dropped.
+func acceptAgent(ln net.Listener, timeout time.Duration, secret string) (net.Conn, error) {
+	if tl, ok := ln.(*net.TCPListener); ok && timeout > 0 {
+		_ = tl.SetDeadline(time.Now().Add(timeout))
+		defer tl.SetDeadline(time.Time{})
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if err := readHello(conn, secret); err != nil {
+			log.Printf("[session] refused agent %s: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+// readHello checks the HELLO frame a CLI must send before anything else.
+func readHello(conn net.Conn, secret string) error {
+	_ = conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	f, err := frame.ReadFrameMax(conn, maxHelloSize)
+	if err != nil {
+		return fmt.Errorf("no hello: %w", err)
+	}
+	if f.Type != frame.TypeHello {
+		return fmt.Errorf("expected hello, got frame type %d", f.Type)
+	}
+	hello, err := frame.DecodeHello(f.Payload)
+	if err != nil {
+		return fmt.Errorf("invalid hello: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(hello.Secret), []byte(secret)) != 1 {
+		return errors.New("invalid agent secret")
+	}
+	return nil
+}
+
+// monitor reports the session's transfer usage and stops it once its
+// quota is used up or it has gone without streams and traffic for its
+// idle timeout.
+func (m *Manager) monitor(s *Session) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastReport := time.Now()
+	lastActive, lastBytes := time.Now(), uint64(0)
+	idle := time.Duration(s.timeouts.SessionIdle)
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case now := <-ticker.C:
+			up, down := s.agents.Usage()
+			if s.Options.QuotaBytes > 0 && up+down >= uint64(s.Options.QuotaBytes) {
+				log.Printf("[session] %s: transfer quota of %d bytes exceeded", s.ID, s.Options.QuotaBytes)
+				m.publish(s, EventQuotaExceeded)
+				m.StopSession(s.ID)
+				return
+			}
+			if up+down != lastBytes || s.agents.Streams() > 0 {
+				lastActive, lastBytes = now, up+down
+			}
+			if idle > 0 && now.Sub(lastActive) >= idle {
+				log.Printf("[session] %s: idle for %s, expiring", s.ID, idle)
+				m.publish(s, EventExpired)
+				m.StopSession(s.ID)
+				return
+			}
+			if now.Sub(lastReport) >= usageInterval {
+				m.publish(s, EventUsage)
+				lastReport = now
+			}
+		}
+	}
+}
+
+func (m *Manager) publish(s *Session, eventType string) {
+	if m.events == nil {
+		return
+	}
+	up, down := s.agents.Usage()
+	m.events.Publish(Event{
+		Type:      eventType,
+		SessionID: s.ID,
+		BytesUp:   up,
+		BytesDown: down,
+		Time:      time.Now(),
+	})
 }
 
 func (m *Manager) StopSession(id string) {
@@ -80,13 +455,25 @@ func (m *Manager) StopSession(id string) {
 		return
 	}
 
-	if s.ExtListener != nil {
-		s.ExtListener.Close()
-	}
-	if s.IntListener != nil {
-		s.IntListener.Close()
-	}
+	s.stopOnce.Do(func() {
+		close(s.quit)
+
+		if s.ExtListener != nil {
+			s.ExtListener.Close()
+		}
+		if s.ExtPacket != nil {
+			s.ExtPacket.Close()
+		}
+		if s.IntListener != nil {
+			s.IntListener.Close()
+		}
+		if s.edgeServer != nil {
+			s.edgeServer.Stop()
+		}
+		s.agents.Stop()
+		m.publish(s, EventUsage)
 
-	m.registry.Remove(id)
-	log.Printf("[session] stopped session %s", id)
+		m.registry.Remove(id)
+		log.Printf("[session] stopped session %s", id)
+	})
 }
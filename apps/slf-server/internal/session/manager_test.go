@@ -0,0 +1,128 @@
+package session_test
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"srv/internal/session"
+	"srv/internal/transport/edge"
+	"srv/internal/transport/frame"
+)
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// dialAgent connects to the internal port once the session listens on it.
+func dialAgent(t *testing.T, port int) net.Conn {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+		if err == nil {
+			return conn
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func sendHello(t *testing.T, conn net.Conn, secret string) {
+	t.Helper()
+	payload := frame.EncodeHello(frame.HelloMeta{Secret: secret})
+	f := &frame.Frame{Type: frame.TypeHello, Length: uint32(len(payload)), Payload: payload}
+	if err := frame.WriteFrame(conn, f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// closed reports whether the server dropped conn.
+func closed(conn net.Conn) bool {
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := conn.Read(make([]byte, 1))
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return false
+	}
+	return err != nil
+}
+
+func TestStartSessionRequiresAgentSecret(t *testing.T) {
+	reg := session.NewRegistry()
+	m := session.NewManager(reg, session.ManagerConfig{}, nil)
+	intPort := freePort(t)
+
+	done := make(chan struct{})
+	go func() {
+		m.StartSession("s1", 0, intPort, session.Options{Mode: session.ModeForward, AgentSecret: "secret"})
+		close(done)
+	}()
+
+	bad := dialAgent(t, intPort)
+	defer bad.Close()
+	sendHello(t, bad, "wrong")
+	if !closed(bad) {
+		t.Fatal("agent with a wrong secret was not dropped")
+	}
+
+	good := dialAgent(t, intPort)
+	defer good.Close()
+	sendHello(t, good, "secret")
+	<-done
+	if _, ok := reg.Get("s1"); !ok {
+		t.Fatal("session not started after a valid hello")
+	}
+	defer m.StopSession("s1")
+
+	joiner := dialAgent(t, intPort)
+	defer joiner.Close()
+	payload := frame.EncodeHealth(frame.HealthMeta{Healthy: true})
+	_ = frame.WriteFrame(joiner, &frame.Frame{Type: frame.TypeHealth, Length: uint32(len(payload)), Payload: payload})
+	if !closed(joiner) {
+		t.Fatal("agent joining without a hello was not dropped")
+	}
+}
+
+func TestStartSessionDropsOversizedHello(t *testing.T) {
+	reg := session.NewRegistry()
+	m := session.NewManager(reg, session.ManagerConfig{}, nil)
+	intPort := freePort(t)
+	go m.StartSession("s3", 0, intPort, session.Options{Mode: session.ModeForward, AgentSecret: "secret"})
+	defer m.StopSession("s3")
+
+	conn := dialAgent(t, intPort)
+	defer conn.Close()
+	// a HELLO header announcing 4 GiB is refused before anything is allocated
+	conn.Write([]byte{frame.TypeHello, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff})
+	if !closed(conn) {
+		t.Fatal("agent announcing an oversized hello was not dropped")
+	}
+}
+
+func TestStartSessionWithoutAgentSecret(t *testing.T) {
+	reg := session.NewRegistry()
+	m := session.NewManager(reg, session.ManagerConfig{}, nil)
+	m.StartSession("s2", 0, freePort(t), session.Options{Mode: session.ModeForward})
+	if _, ok := reg.Get("s2"); ok {
+		t.Fatal("session started without an agent secret")
+	}
+}
+
+func TestStartSessionRejectsInvalidOAuthProxies(t *testing.T) {
+	reg := session.NewRegistry()
+	m := session.NewManager(reg, session.ManagerConfig{}, nil)
+	access := &edge.AccessPolicy{OAuthHeader: "X-Auth-Request-Email", OAuthProxies: []string{"10.0.0.0/33"}}
+	m.StartSession("s4", 0, freePort(t), session.Options{Mode: session.ModeForward, AgentSecret: "secret", Access: access})
+	if _, ok := reg.Get("s4"); ok {
+		t.Fatal("session started with an invalid oauthProxies entry")
+	}
+}
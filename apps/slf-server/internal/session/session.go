@@ -1,11 +1,11 @@
 package session
 
 import (
-	"fmt"
-	"log"
 	"net"
-	"srv/internal/transport/mux"
+	"srv/internal/transport/edge"
+	"srv/internal/transport/shaper"
 	"sync"
+	"sync/atomic"
 )
 
 type Session struct {
@@ -13,37 +13,17 @@ type Session struct {
 	ExternalPort int
 	InternalPort int
 	ExtListener  net.Listener
-	IntListener  net.Listener //optional, I'll use it later maybe.
+	ExtPacket    net.PacketConn // external socket of udp sessions
+	IntListener  net.Listener   // agents join the session here
 	Active       bool
-	muxServer    *mux.Server
-	mu           sync.Mutex
+	Options      Options
+	timeouts     Timeouts      // server settings with the session's applied
+	Rejected     atomic.Uint64 // external connections refused by session policies
+	ipFilter     *IPFilter
+	limiter      *ConnLimiter
+	agents       *AgentGroup
+	up, down     *shaper.Limiter // shared by all agents
+	edgeServer   *edge.Server
+	quit         chan struct{}
+	stopOnce     sync.Once
 }
-
-func (s *Session) WaitForInternalReconnect() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	log.Printf("[session] waiting for internal client to reconnect on :%d...", s.InternalPort)
-
-	internalLn, err := net.Listen("tcp", fmt.Sprintf(":%d", s.InternalPort))
-	if err != nil {
-		log.Printf("[session] failed to listen again on internal port %d: %v", s.InternalPort, err)
-		return
-	}
-	defer internalLn.Close()
-
-	internalConn, err := internalLn.Accept()
-	if err != nil {
-		log.Printf("[session] failed to accept new internal connection: %v", err)
-		return
-	}
-
-	log.Printf("[session] internal client reconnected")
-
-	if s.muxServer != nil {
-		s.muxServer.SetInternalConn(internalConn)
-	} else {
-		log.Printf("[session] error: no muxServer available for session %s", s.ID)
-		internalConn.Close()
-	}
-}
\ No newline at end of file
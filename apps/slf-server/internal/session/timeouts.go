@@ -0,0 +1,93 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration written as a string like "30s" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	if v < 0 {
+		return fmt.Errorf("duration %q is negative", s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Timeouts bound the phases of a session's lifetime. The server's settings
+// are ceilings for the session's own; DefaultTimeouts fill what neither
+// sets. The stream and session idle limits and the stream lifetime are off
+// unless set.
+type Timeouts struct {
+	AgentConnect   Duration `json:"agentConnect,omitempty"`   // wait for the first CLI after the session starts
+	AgentWait      Duration `json:"agentWait,omitempty"`      // a new stream waits for an agent to attach or recover
+	Dial           Duration `json:"dial,omitempty"`           // dials made by the server for forward sessions
+	StreamIdle     Duration `json:"streamIdle,omitempty"`     // close streams without traffic in either direction
+	StreamLifetime Duration `json:"streamLifetime,omitempty"` // close streams open longer than this
+	SessionIdle    Duration `json:"sessionIdle,omitempty"`    // stop sessions without streams or traffic
+}
+
+// maxAgentWait bounds AgentWait, since every stream waiting for an agent
+// holds an external connection open.
+const maxAgentWait = Duration(30 * time.Second)
+
+// DefaultTimeouts are used for whatever neither the server nor the
+// session sets.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		AgentConnect: Duration(2 * time.Minute),
+		AgentWait:    Duration(5 * time.Second),
+		Dial:         Duration(10 * time.Second),
+	}
+}
+
+// Merge combines the server's timeouts t with a session's o. Each field
+// is the shorter of the two when both are set, so a session can tighten
+// the server's limits but never loosen them.
+func (t Timeouts) Merge(o *Timeouts) Timeouts {
+	if o == nil {
+		return t
+	}
+	limit := func(dst *Duration, v Duration) {
+		if v > 0 && (*dst == 0 || v < *dst) {
+			*dst = v
+		}
+	}
+	limit(&t.AgentConnect, o.AgentConnect)
+	limit(&t.AgentWait, o.AgentWait)
+	limit(&t.Dial, o.Dial)
+	limit(&t.StreamIdle, o.StreamIdle)
+	limit(&t.StreamLifetime, o.StreamLifetime)
+	limit(&t.SessionIdle, o.SessionIdle)
+	return t
+}
+
+// WithDefaults fills unset fields from DefaultTimeouts and caps AgentWait.
+func (t Timeouts) WithDefaults() Timeouts {
+	d := DefaultTimeouts()
+	fill := func(dst *Duration, v Duration) {
+		if *dst == 0 {
+			*dst = v
+		}
+	}
+	fill(&t.AgentConnect, d.AgentConnect)
+	fill(&t.AgentWait, d.AgentWait)
+	fill(&t.Dial, d.Dial)
+	t.AgentWait = min(t.AgentWait, maxAgentWait)
+	return t
+}
@@ -0,0 +1,58 @@
+package session_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"srv/internal/session"
+)
+
+func TestTimeoutsMerge(t *testing.T) {
+	server := session.Timeouts{
+		StreamIdle:  session.Duration(time.Minute),
+		SessionIdle: session.Duration(time.Hour),
+	}
+
+	var opts session.Timeouts
+	err := json.Unmarshal([]byte(`{"agentWait":"20s","streamIdle":"10m","sessionIdle":"30m","dial":"2s"}`), &opts)
+	if err != nil {
+		t.Fatalf("failed to decode timeouts: %v", err)
+	}
+	got := server.Merge(&opts).WithDefaults()
+
+	if got.StreamIdle != session.Duration(time.Minute) {
+		t.Errorf("a session must not loosen the server's stream idle timeout, got %s", time.Duration(got.StreamIdle))
+	}
+	if got.SessionIdle != session.Duration(30*time.Minute) {
+		t.Errorf("expected the session's shorter idle expiry, got %s", time.Duration(got.SessionIdle))
+	}
+	if got.AgentWait != session.Duration(20*time.Second) {
+		t.Errorf("expected the session's agent wait, got %s", time.Duration(got.AgentWait))
+	}
+	if got.Dial != session.Duration(2*time.Second) {
+		t.Errorf("expected the session's dial timeout, got %s", time.Duration(got.Dial))
+	}
+	if got.AgentConnect != session.DefaultTimeouts().AgentConnect {
+		t.Errorf("expected the default agent connect wait, got %s", time.Duration(got.AgentConnect))
+	}
+	if server.Merge(nil) != server {
+		t.Error("merging nil should change nothing")
+	}
+}
+
+func TestTimeoutsCapAgentWait(t *testing.T) {
+	got := session.Timeouts{}.Merge(&session.Timeouts{AgentWait: session.Duration(time.Hour)}).WithDefaults()
+	if got.AgentWait != session.Duration(30*time.Second) {
+		t.Errorf("expected agent wait capped at 30s, got %s", time.Duration(got.AgentWait))
+	}
+}
+
+func TestDurationRejectsInvalidValues(t *testing.T) {
+	for _, in := range []string{`30`, `"soon"`, `"-5s"`} {
+		var d session.Duration
+		if err := json.Unmarshal([]byte(in), &d); err == nil {
+			t.Errorf("expected %s to be rejected", in)
+		}
+	}
+}
@@ -1 +1,53 @@
-package session
\ No newline at end of file
+package session
+
+import "srv/internal/transport/edge"
+
+const (
+	ProtocolTCP  = "tcp"
+	ProtocolHTTP = "http"
+	ProtocolUDP  = "udp"
+)
+
+const (
+	ModePublic  = ""        // exposes the CLI's service on the external port
+	ModeForward = "forward" // no external port; the CLI opens streams to remote targets
+	ModePrivate = "private" // no external port; reached by forward sessions holding the share token
+)
+
+// Options are the per-session settings carried in the start message.
+type Options struct {
+	Mode        string
+	Protocol    string
+	Balance     string // how external streams are spread across agents
+	Access      *edge.AccessPolicy
+	Headers     *edge.HeaderRules
+	ErrorPages  *edge.ErrorPages // replace the pages shown when the local service is unreachable
+	AllowCIDRs  []string
+	DenyCIDRs   []string
+	RateLimit   *RateLimit
+	Bandwidth   *Bandwidth
+	QuotaBytes  int64  // remaining transfer allowance, zero for unlimited
+	ShareToken  string // lets forward sessions of other owners reach a private session
+	Owner       string // API key that created the session; its own forward sessions may reach it
+	AgentSecret string // CLIs present it in a HELLO frame before they become agents
+	Timeouts    *Timeouts
+}
+
+// Exposed reports whether the session listens on its external port.
+func (o Options) Exposed() bool {
+	return o.Mode == ModePublic
+}
+
+// Bandwidth limits a session's throughput in bytes per second. Up is
+// traffic from the CLI to external clients, down the reverse.
+type Bandwidth struct {
+	UpBytesPerSec   int64 `json:"upBytesPerSec,omitempty"`
+	DownBytesPerSec int64 `json:"downBytesPerSec,omitempty"`
+}
+
+func (o Options) IsHTTP() bool {
+	if o.Protocol == ProtocolUDP || !o.Exposed() {
+		return false
+	}
+	return o.Protocol == ProtocolHTTP || o.Access.Enabled() || o.Headers != nil || o.ErrorPages != nil
+}
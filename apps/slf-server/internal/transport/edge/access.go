@@ -0,0 +1,135 @@
+package edge
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// AccessPolicy restricts who may reach an HTTP session. A request is let
+// through when it satisfies any of the configured methods.
+type AccessPolicy struct {
+	BasicAuth   *BasicAuth `json:"basicAuth,omitempty"`
+	BearerToken string     `json:"bearerToken,omitempty"`
+	OAuthHeader string     `json:"oauthHeader,omitempty"` // header set by an upstream OAuth proxy, must be non-empty
+	// OAuthProxies are the CIDRs the OAuth proxy connects from. OAuthHeader
+	// only counts on requests from them; from anywhere else it is removed.
+	OAuthProxies []string `json:"oauthProxies,omitempty"`
+
+	proxies []netip.Prefix // OAuthProxies, parsed by Compile
+}
+
+// Compile parses OAuthProxies, failing on an invalid entry. It must be
+// called once before the policy is used; until then requests never count
+// as coming from the OAuth proxy.
+func (p *AccessPolicy) Compile() error {
+	if p == nil {
+		return nil
+	}
+	proxies, err := ParsePrefixes(p.OAuthProxies)
+	if err != nil {
+		return fmt.Errorf("oauthProxies: %w", err)
+	}
+	p.proxies = proxies
+	return nil
+}
+
+func (p *AccessPolicy) Enabled() bool {
+	return p != nil && (p.BasicAuth != nil || p.BearerToken != "" || p.OAuthHeader != "")
+}
+
+func (p *AccessPolicy) Allow(r *http.Request) bool {
+	if !p.Enabled() {
+		return true
+	}
+
+	if p.BasicAuth != nil {
+		user, pass, ok := r.BasicAuth()
+		if ok && equal(user, p.BasicAuth.Username) && equal(pass, p.BasicAuth.Password) {
+			return true
+		}
+	}
+
+	if p.BearerToken != "" {
+		auth := r.Header.Get("Authorization")
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok && equal(token, p.BearerToken) {
+			return true
+		}
+	}
+
+	if p.OAuthHeader != "" && r.Header.Get(p.OAuthHeader) != "" && p.fromOAuthProxy(r) {
+		return true
+	}
+
+	return false
+}
+
+// fromOAuthProxy reports whether r comes straight from a trusted OAuth proxy.
+func (p *AccessPolicy) fromOAuthProxy(r *http.Request) bool {
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := ap.Addr().Unmap()
+	for _, prefix := range p.proxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripUntrusted removes an OAuth identity header a client set itself, so
+// the local service never sees a forged one.
+func (p *AccessPolicy) stripUntrusted(r *http.Request) {
+	if p == nil || p.OAuthHeader == "" || p.fromOAuthProxy(r) {
+		return
+	}
+	r.Header.Del(p.OAuthHeader)
+}
+
+func (p *AccessPolicy) deny(w http.ResponseWriter) {
+	if p.BasicAuth != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="selfgrok"`)
+	} else if p.BearerToken != "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="selfgrok"`)
+	}
+	http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// ParsePrefixes parses a list of CIDRs or single addresses, skipping
+// empty entries. IPv4-mapped addresses are unmapped.
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", s, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(p.Addr().Unmap(), p.Bits()).Masked())
+	}
+	return prefixes, nil
+}
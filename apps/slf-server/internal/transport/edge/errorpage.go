@@ -0,0 +1,171 @@
+package edge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"srv/internal/transport/frame"
+	"srv/internal/transport/mux"
+)
+
+// Errors an Opener returns to pick the page shown when no stream can be
+// opened. Any other error is shown as a 502.
+var (
+	ErrOffline     = errors.New("tunnel is offline")            // no CLI attached, 503
+	ErrUnavailable = errors.New("local service is unavailable") // the CLI reports it down, 502
+)
+
+// MaxErrorPageSize caps each custom error page. Larger ones are replaced
+// by the built-in page.
+const MaxErrorPageSize = 64 << 10
+
+// ErrorPages replace the built-in pages shown when a request cannot reach
+// the local service. They are plain text in which {{status}}, {{title}}
+// and {{message}} are replaced, HTML-escaped in the HTML page and
+// JSON-escaped in the JSON one. The JSON page is used when the client asks
+// for JSON in its Accept header.
+type ErrorPages struct {
+	HTML string `json:"html,omitempty"`
+	JSON string `json:"json,omitempty"`
+}
+
+// Validate reports pages too large to be used.
+func (p *ErrorPages) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if len(p.HTML) > MaxErrorPageSize || len(p.JSON) > MaxErrorPageSize {
+		return errors.New("error page larger than 64 KiB")
+	}
+	return nil
+}
+
+// PageData describes an error for the pages.
+type PageData struct {
+	Status  int    `json:"status"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+const defaultHTMLPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{status}} {{title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 40rem; margin: 4rem auto; padding: 0 1rem; color: #222; }
+h1 { font-size: 1.5rem; }
+p { line-height: 1.5; }
+small { color: #888; }
+</style>
+</head>
+<body>
+<h1>{{status}} {{title}}</h1>
+<p>{{message}}</p>
+<small>selfgrok</small>
+</body>
+</html>
+`
+
+type errorPages struct {
+	html string
+	json string // empty renders PageData as JSON
+}
+
+// compileErrorPages picks the pages to render. A custom page over
+// MaxErrorPageSize is logged and replaced by the built-in one.
+func compileErrorPages(p *ErrorPages) *errorPages {
+	pages := &errorPages{html: defaultHTMLPage}
+	if p == nil {
+		return pages
+	}
+	if p.HTML != "" {
+		if len(p.HTML) > MaxErrorPageSize {
+			log.Printf("[edge] HTML error page over %d bytes, using the default", MaxErrorPageSize)
+		} else {
+			pages.html = p.HTML
+		}
+	}
+	if p.JSON != "" {
+		if len(p.JSON) > MaxErrorPageSize {
+			log.Printf("[edge] JSON error page over %d bytes, using the default", MaxErrorPageSize)
+		} else {
+			pages.json = p.JSON
+		}
+	}
+	return pages
+}
+
+// pageFor describes the error a request failed with.
+func pageFor(err error) PageData {
+	var netErr net.Error
+	var streamErr *mux.StreamError
+	switch {
+	case errors.Is(err, ErrOffline):
+		return PageData{http.StatusServiceUnavailable, "Tunnel offline",
+			"The client serving this tunnel is not connected. Try again in a moment."}
+	case errors.Is(err, ErrUnavailable):
+		return PageData{http.StatusBadGateway, "Local service unavailable",
+			"The tunnel is up but the service behind it is not running."}
+	case errors.As(err, &streamErr) && streamErr.Reason == frame.CloseRefused:
+		return PageData{http.StatusBadGateway, "Local service unavailable",
+			"The tunnel is up but the service behind it refused the connection."}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return PageData{http.StatusGatewayTimeout, "Gateway timeout",
+			"The service behind this tunnel did not answer in time."}
+	default:
+		return PageData{http.StatusBadGateway, "Bad gateway",
+			"The service behind this tunnel closed the connection without answering."}
+	}
+}
+
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "json") && !strings.Contains(accept, "text/html")
+}
+
+// jsonString escapes s for use inside a JSON string literal.
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
+
+// write sends the page for data, as JSON or HTML depending on r.
+func (p *errorPages) write(w http.ResponseWriter, r *http.Request, data PageData) {
+	status := strconv.Itoa(data.Status)
+	var body string
+	contentType := "text/html; charset=utf-8"
+	if wantsJSON(r) {
+		contentType = "application/json"
+		if p.json == "" {
+			b, _ := json.Marshal(data)
+			body = string(b)
+		} else {
+			body = strings.NewReplacer(
+				"{{status}}", status,
+				"{{title}}", jsonString(data.Title),
+				"{{message}}", jsonString(data.Message),
+			).Replace(p.json)
+		}
+	} else {
+		body = strings.NewReplacer(
+			"{{status}}", status,
+			"{{title}}", html.EscapeString(data.Title),
+			"{{message}}", html.EscapeString(data.Message),
+		).Replace(p.html)
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	h.Set("Cache-Control", "no-store")
+	w.WriteHeader(data.Status)
+	_, _ = w.Write([]byte(body))
+}
@@ -0,0 +1,39 @@
+package edge
+
+import "net/http"
+
+// HeaderRules rewrite the headers of proxied requests and responses.
+type HeaderRules struct {
+	Host           string            `json:"host,omitempty"` // replaces the Host header sent to the CLI
+	RequestAdd     map[string]string `json:"requestAdd,omitempty"`
+	RequestRemove  []string          `json:"requestRemove,omitempty"`
+	ResponseAdd    map[string]string `json:"responseAdd,omitempty"`
+	ResponseRemove []string          `json:"responseRemove,omitempty"`
+}
+
+func (h *HeaderRules) rewriteRequest(r *http.Request) {
+	if h == nil {
+		return
+	}
+	for _, k := range h.RequestRemove {
+		r.Header.Del(k)
+	}
+	for k, v := range h.RequestAdd {
+		r.Header.Set(k, v)
+	}
+	if h.Host != "" {
+		r.Host = h.Host
+	}
+}
+
+func (h *HeaderRules) rewriteResponse(res *http.Response) {
+	if h == nil {
+		return
+	}
+	for _, k := range h.ResponseRemove {
+		res.Header.Del(k)
+	}
+	for k, v := range h.ResponseAdd {
+		res.Header.Set(k, v)
+	}
+}
@@ -0,0 +1,127 @@
+package edge
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"time"
+)
+
+// Opener opens a new stream to the CLI behind the session. It returns
+// ErrOffline or ErrUnavailable to pick the error page shown.
+type Opener func() (net.Conn, error)
+
+// defaultResponseTimeout bounds the wait for the local service's response
+// headers before the client gets a 504.
+const defaultResponseTimeout = 100 * time.Second
+
+// idleConnTimeout is how long an idle pooled stream is kept for reuse.
+const idleConnTimeout = 90 * time.Second
+
+type Config struct {
+	Access          *AccessPolicy
+	Headers         *HeaderRules
+	ErrorPages      *ErrorPages
+	ResponseTimeout time.Duration // defaultResponseTimeout when zero
+	StreamIdle      time.Duration // the mux closes streams idle this long, zero for never
+}
+
+// Server is the HTTP front of a session. Requests are checked against the
+// session's policies before a stream to the CLI is opened.
+type Server struct {
+	cfg   Config
+	ln    *connListener
+	srv   *http.Server
+	proxy *httputil.ReverseProxy
+	pages *errorPages
+}
+
+func NewServer(cfg Config, open Opener) *Server {
+	if cfg.ResponseTimeout <= 0 {
+		cfg.ResponseTimeout = defaultResponseTimeout
+	}
+	// retire pooled streams well before the mux reaps them, so a request
+	// never goes out on a stream that is being closed
+	idle := idleConnTimeout
+	if cfg.StreamIdle > 0 {
+		idle = min(idle, cfg.StreamIdle/2)
+	}
+	s := &Server{
+		cfg:   cfg,
+		ln:    newConnListener(),
+		pages: compileErrorPages(cfg.ErrorPages),
+	}
+
+	s.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = pr.In.Host
+			pr.SetXForwarded()
+			cfg.Headers.rewriteRequest(pr.Out)
+		},
+		ModifyResponse: func(res *http.Response) error {
+			cfg.Headers.rewriteResponse(res)
+			return nil
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return open()
+			},
+			DisableCompression:    true,
+			MaxIdleConnsPerHost:   16,
+			IdleConnTimeout:       idle,
+			ResponseHeaderTimeout: cfg.ResponseTimeout,
+		},
+		ErrorHandler: s.proxyError,
+		ErrorLog:     log.Default(),
+	}
+
+	s.srv = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	return s
+}
+
+func (s *Server) Start() {
+	go func() {
+		if err := s.srv.Serve(s.ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("[edge] serve error: %v", err)
+		}
+	}()
+}
+
+// ServeConn hands an accepted external connection to the HTTP server.
+func (s *Server) ServeConn(conn net.Conn) {
+	s.ln.push(conn)
+}
+
+func (s *Server) Stop() {
+	s.srv.Close()
+	s.ln.Close()
+	log.Println("[edge] server stopped")
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Access.Allow(r) {
+		log.Printf("[edge] denied %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		s.cfg.Access.deny(w)
+		return
+	}
+	s.cfg.Access.stripUntrusted(r)
+
+	s.proxy.ServeHTTP(w, r)
+}
+
+// proxyError answers a request that could not be proxied with an error
+// page. Clients that went away get nothing.
+func (s *Server) proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() != nil {
+		return
+	}
+	page := pageFor(err)
+	log.Printf("[edge] %s %s failed with %d: %v", r.Method, r.URL.Path, page.Status, err)
+	s.pages.write(w, r, page)
+}
@@ -0,0 +1,361 @@
+package edge_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"srv/internal/transport/edge"
+	"srv/internal/transport/frame"
+	"srv/internal/transport/mux"
+)
+
+// upstream answers every request on a stream with a fixed 200 response and
+// reports the requests it received on seen, when set.
+func upstream(opened *int32, seen chan<- *http.Request) edge.Opener {
+	return func() (net.Conn, error) {
+		atomic.AddInt32(opened, 1)
+		local, remote := net.Pipe()
+		go func() {
+			defer remote.Close()
+			br := bufio.NewReader(remote)
+			for {
+				req, err := http.ReadRequest(br)
+				if err != nil {
+					return
+				}
+				io.Copy(io.Discard, req.Body)
+				if seen != nil {
+					seen <- req
+				}
+				remote.Write([]byte("HTTP/1.1 200 OK\r\nX-Powered-By: dev\r\nContent-Length: 2\r\n\r\nok"))
+			}
+		}()
+		return local, nil
+	}
+}
+
+func roundTrip(t *testing.T, s *edge.Server, req *http.Request) *http.Response {
+	t.Helper()
+	client, conn := net.Pipe()
+	go s.ServeConn(conn)
+
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	if err := req.Write(client); err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+	res, err := http.ReadResponse(bufio.NewReader(client), req)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	return res
+}
+
+func TestServerDeniesWithoutCredentials(t *testing.T) {
+	var opened int32
+	s := edge.NewServer(edge.Config{
+		Access: &edge.AccessPolicy{BasicAuth: &edge.BasicAuth{Username: "dev", Password: "secret"}},
+	}, upstream(&opened, nil))
+	s.Start()
+	defer s.Stop()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.test/", nil)
+	res := roundTrip(t, s, req)
+
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", res.StatusCode)
+	}
+	if res.Header.Get("WWW-Authenticate") == "" {
+		t.Error("expected WWW-Authenticate header")
+	}
+	if atomic.LoadInt32(&opened) != 0 {
+		t.Error("expected no stream to be opened for a denied request")
+	}
+}
+
+func TestServerAllowsBasicAuth(t *testing.T) {
+	var opened int32
+	s := edge.NewServer(edge.Config{
+		Access: &edge.AccessPolicy{BasicAuth: &edge.BasicAuth{Username: "dev", Password: "secret"}},
+	}, upstream(&opened, nil))
+	s.Start()
+	defer s.Stop()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.test/", nil)
+	req.SetBasicAuth("dev", "secret")
+	res := roundTrip(t, s, req)
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.StatusCode)
+	}
+	if atomic.LoadInt32(&opened) != 1 {
+		t.Errorf("expected one stream, got %d", opened)
+	}
+}
+
+func TestServerRewritesHeaders(t *testing.T) {
+	var opened int32
+	seen := make(chan *http.Request, 1)
+	s := edge.NewServer(edge.Config{
+		Headers: &edge.HeaderRules{
+			Host:           "localhost:3000",
+			RequestAdd:     map[string]string{"X-Env": "dev"},
+			RequestRemove:  []string{"Cookie"},
+			ResponseAdd:    map[string]string{"X-Tunnel": "selfgrok"},
+			ResponseRemove: []string{"X-Powered-By"},
+		},
+	}, upstream(&opened, seen))
+	s.Start()
+	defer s.Stop()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://app.example.test/hook", nil)
+	req.Header.Set("Cookie", "session=1")
+	res := roundTrip(t, s, req)
+
+	got := <-seen
+	if got.Host != "localhost:3000" {
+		t.Errorf("expected rewritten host, got %q", got.Host)
+	}
+	if got.Header.Get("X-Forwarded-Host") != "app.example.test" {
+		t.Errorf("expected X-Forwarded-Host app.example.test, got %q", got.Header.Get("X-Forwarded-Host"))
+	}
+	if got.Header.Get("X-Forwarded-Proto") != "http" {
+		t.Errorf("expected X-Forwarded-Proto http, got %q", got.Header.Get("X-Forwarded-Proto"))
+	}
+	if got.Header.Get("X-Env") != "dev" || got.Header.Get("Cookie") != "" {
+		t.Errorf("request headers not rewritten: %v", got.Header)
+	}
+
+	if res.Header.Get("X-Tunnel") != "selfgrok" || res.Header.Get("X-Powered-By") != "" {
+		t.Errorf("response headers not rewritten: %v", res.Header)
+	}
+}
+
+func TestServerShowsOfflinePage(t *testing.T) {
+	s := edge.NewServer(edge.Config{}, func() (net.Conn, error) {
+		return nil, fmt.Errorf("%w: no agents connected", edge.ErrOffline)
+	})
+	s.Start()
+	defer s.Stop()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.test/", nil)
+	res := roundTrip(t, s, req)
+	body, _ := io.ReadAll(res.Body)
+
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", res.StatusCode)
+	}
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("expected an HTML page, got %q", res.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), "Tunnel offline") {
+		t.Errorf("expected the offline page, got %q", body)
+	}
+}
+
+func TestServerRendersCustomJSONPage(t *testing.T) {
+	s := edge.NewServer(edge.Config{
+		ErrorPages: &edge.ErrorPages{JSON: `{"code":{{status}},"reason":"{{title}}"}`},
+	}, func() (net.Conn, error) {
+		return nil, edge.ErrUnavailable
+	})
+	s.Start()
+	defer s.Stop()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.test/api", nil)
+	req.Header.Set("Accept", "application/json")
+	res := roundTrip(t, s, req)
+	body, _ := io.ReadAll(res.Body)
+
+	if res.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", res.StatusCode)
+	}
+	if res.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected JSON, got %q", res.Header.Get("Content-Type"))
+	}
+	if want := `{"code":502,"reason":"Local service unavailable"}`; string(body) != want {
+		t.Errorf("expected %s, got %s", want, body)
+	}
+}
+
+func TestServerShowsBadGatewayOnStreamReset(t *testing.T) {
+	s := edge.NewServer(edge.Config{}, func() (net.Conn, error) {
+		local, remote := net.Pipe()
+		go func() {
+			// the CLI closes the stream when its local dial fails
+			http.ReadRequest(bufio.NewReader(remote))
+			remote.Close()
+		}()
+		return local, nil
+	})
+	s.Start()
+	defer s.Stop()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.test/", nil)
+	res := roundTrip(t, s, req)
+
+	if res.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", res.StatusCode)
+	}
+}
+
+func TestServerShowsPageForClientCloseReason(t *testing.T) {
+	tests := []struct {
+		reason string
+		status int
+		title  string
+	}{
+		{frame.CloseRefused, http.StatusBadGateway, "Local service unavailable"},
+		{frame.CloseTimeout, http.StatusGatewayTimeout, "Gateway timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			internal, client := net.Pipe()
+			agent := mux.NewServer(internal)
+			agent.Start()
+			defer agent.Stop()
+			go func() {
+				// the CLI closes the stream with a reason when its local dial fails
+				connect, err := frame.ReadFrame(client)
+				if err != nil {
+					return
+				}
+				payload := frame.EncodeClose(frame.CloseMeta{Reason: tt.reason, Detail: "dial tcp 127.0.0.1:3000"})
+				frame.WriteFrame(client, &frame.Frame{Type: frame.TypeClose, StreamID: connect.StreamID, Length: uint32(len(payload)), Payload: payload})
+				io.Copy(io.Discard, client)
+			}()
+
+			s := edge.NewServer(edge.Config{
+				ErrorPages: &edge.ErrorPages{HTML: "<h1>{{status}} {{title}}</h1>{{message}}<script>{{.Status}}</script>"},
+			}, agent.OpenStream)
+			s.Start()
+			defer s.Stop()
+
+			req, _ := http.NewRequest(http.MethodGet, "http://example.test/", nil)
+			res := roundTrip(t, s, req)
+			body, _ := io.ReadAll(res.Body)
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, res.StatusCode, body)
+			}
+			want := fmt.Sprintf("<h1>%d %s</h1>", tt.status, tt.title)
+			if !strings.HasPrefix(string(body), want) || !strings.Contains(string(body), "{{.Status}}") {
+				t.Errorf("expected placeholders replaced and nothing else, got %q", body)
+			}
+		})
+	}
+}
+
+func TestServerIgnoresOversizedErrorPage(t *testing.T) {
+	s := edge.NewServer(edge.Config{
+		ErrorPages: &edge.ErrorPages{HTML: strings.Repeat("x", edge.MaxErrorPageSize+1)},
+	}, func() (net.Conn, error) {
+		return nil, edge.ErrOffline
+	})
+	s.Start()
+	defer s.Stop()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.test/", nil)
+	res := roundTrip(t, s, req)
+	body, _ := io.ReadAll(res.Body)
+	if !strings.Contains(string(body), "Tunnel offline") {
+		t.Errorf("expected the built-in page, got %d bytes", len(body))
+	}
+}
+
+func TestAccessPolicyAllow(t *testing.T) {
+	p := &edge.AccessPolicy{
+		BearerToken:  "t0ken",
+		OAuthHeader:  "X-Auth-Request-Email",
+		OAuthProxies: []string{"10.0.0.0/8", "192.0.2.1"},
+	}
+	if err := p.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	email := http.Header{"X-Auth-Request-Email": {"dev@example.com"}}
+
+	tests := []struct {
+		name   string
+		remote string
+		header http.Header
+		want   bool
+	}{
+		{"no credentials", "203.0.113.7:4000", http.Header{}, false},
+		{"wrong token", "203.0.113.7:4000", http.Header{"Authorization": {"Bearer nope"}}, false},
+		{"bearer token", "203.0.113.7:4000", http.Header{"Authorization": {"Bearer t0ken"}}, true},
+		{"oauth header from proxy", "10.1.2.3:4000", email, true},
+		{"oauth header from proxy address", "192.0.2.1:4000", email, true},
+		{"oauth header from mapped proxy address", "[::ffff:10.1.2.3]:4000", email, true},
+		{"oauth header from client", "203.0.113.7:4000", email, false},
+		{"oauth proxy without header", "10.1.2.3:4000", http.Header{}, false},
+	}
+
+	for _, tt := range tests {
+		r := &http.Request{Header: tt.header, RemoteAddr: tt.remote}
+		if got := p.Allow(r); got != tt.want {
+			t.Errorf("%s: Allow() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	var nilPolicy *edge.AccessPolicy
+	if !nilPolicy.Allow(&http.Request{Header: http.Header{}}) {
+		t.Error("nil policy should allow every request")
+	}
+}
+
+func TestAccessPolicyCompile(t *testing.T) {
+	tests := []struct {
+		proxies []string
+		ok      bool
+	}{
+		{proxies: nil, ok: true},
+		{proxies: []string{"10.0.0.0/8", " 192.0.2.1 ", ""}, ok: true},
+		{proxies: []string{"fd00::/8"}, ok: true},
+		{proxies: []string{"10.0.0.0/33"}, ok: false},
+		{proxies: []string{"proxy.internal"}, ok: false},
+	}
+	for _, tt := range tests {
+		p := &edge.AccessPolicy{OAuthHeader: "X-Auth-Request-Email", OAuthProxies: tt.proxies}
+		if err := p.Compile(); (err == nil) != tt.ok {
+			t.Errorf("Compile(%q) error = %v, want ok %v", tt.proxies, err, tt.ok)
+		}
+	}
+
+	var nilPolicy *edge.AccessPolicy
+	if err := nilPolicy.Compile(); err != nil {
+		t.Errorf("nil policy: %v", err)
+	}
+}
+
+func TestServerStripsForgedOAuthHeader(t *testing.T) {
+	seen := make(chan *http.Request, 1)
+	var opened int32
+	access := &edge.AccessPolicy{
+		BearerToken:  "t0ken",
+		OAuthHeader:  "X-Auth-Request-Email",
+		OAuthProxies: []string{"10.0.0.0/8"},
+	}
+	if err := access.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	s := edge.NewServer(edge.Config{Access: access}, upstream(&opened, seen))
+	s.Start()
+	defer s.Stop()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.test/", nil)
+	req.Header.Set("Authorization", "Bearer t0ken")
+	req.Header.Set("X-Auth-Request-Email", "admin@example.com")
+	res := roundTrip(t, s, req)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.StatusCode)
+	}
+	if got := (<-seen).Header.Get("X-Auth-Request-Email"); got != "" {
+		t.Errorf("forged OAuth header reached the local service: %q", got)
+	}
+}
@@ -2,14 +2,22 @@ package frame
 
 import (
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 )
 
 const (
-	TypeConnect = 1
-	TypeData    = 2
-	TypeClose   = 3
+	TypeConnect  = 1
+	TypeData     = 2
+	TypeClose    = 3
+	TypeDatagram = 4 // one UDP datagram per frame
+	TypeOpen     = 5 // stream opened by the internal client, acked with CONNECT
+	TypeHealth   = 6 // health of the internal client's local service, stream 0
+	TypeHello    = 7 // first frame of an internal client, carries the agent secret
+	TypePing     = 8 // sent by the internal client on stream 0, echoed as PONG
+	TypePong     = 9 // reply to PING carrying its payload
 )
 
 type Frame struct {
@@ -19,7 +27,118 @@ type Frame struct {
 	Payload  []byte
 }
 
+// ConnectMeta is the payload of a CONNECT frame. It describes the external
+// connection behind the stream; older peers send an empty payload.
+type ConnectMeta struct {
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	LocalAddr  string `json:"localAddr,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`   // "udp" for datagram streams, empty for tcp
+	TargetPort int    `json:"targetPort,omitempty"` // forwarded stream: dial this port on the client's host
+}
+
+func EncodeConnect(m ConnectMeta) []byte {
+	b, _ := json.Marshal(m)
+	return b
+}
+
+func DecodeConnect(payload []byte) (ConnectMeta, error) {
+	var m ConnectMeta
+	if len(payload) == 0 {
+		return m, nil
+	}
+	err := json.Unmarshal(payload, &m)
+	return m, err
+}
+
+// OpenMeta is the payload of an OPEN frame.
+type OpenMeta struct {
+	Target     string `json:"target"` // "<session>", "<session>:<port>" or "host:port"
+	ShareToken string `json:"shareToken,omitempty"`
+}
+
+func EncodeOpen(m OpenMeta) []byte {
+	b, _ := json.Marshal(m)
+	return b
+}
+
+func DecodeOpen(payload []byte) (OpenMeta, error) {
+	var m OpenMeta
+	err := json.Unmarshal(payload, &m)
+	return m, err
+}
+
+// HealthMeta is the payload of a HEALTH frame.
+type HealthMeta struct {
+	Healthy bool   `json:"healthy"`
+	Detail  string `json:"detail,omitempty"` // why the local service is unhealthy
+}
+
+func EncodeHealth(m HealthMeta) []byte {
+	b, _ := json.Marshal(m)
+	return b
+}
+
+func DecodeHealth(payload []byte) (HealthMeta, error) {
+	var m HealthMeta
+	err := json.Unmarshal(payload, &m)
+	return m, err
+}
+
+// Reasons the internal client gives for closing a stream it could not
+// connect to its local service.
+const (
+	CloseRefused = "refused" // the local service refused the connection
+	CloseTimeout = "timeout" // the local service did not accept in time
+)
+
+// CloseMeta is the optional payload of a CLOSE frame.
+type CloseMeta struct {
+	Reason string `json:"reason,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func EncodeClose(m CloseMeta) []byte {
+	b, _ := json.Marshal(m)
+	return b
+}
+
+func DecodeClose(payload []byte) (CloseMeta, error) {
+	var m CloseMeta
+	if len(payload) == 0 {
+		return m, nil
+	}
+	err := json.Unmarshal(payload, &m)
+	return m, err
+}
+
+// HelloMeta is the payload of a HELLO frame.
+type HelloMeta struct {
+	Secret string `json:"secret"`
+}
+
+func EncodeHello(m HelloMeta) []byte {
+	b, _ := json.Marshal(m)
+	return b
+}
+
+func DecodeHello(payload []byte) (HelloMeta, error) {
+	var m HelloMeta
+	err := json.Unmarshal(payload, &m)
+	return m, err
+}
+
+// ErrFrameTooLarge is returned by ReadFrameMax for frames whose payload
+// exceeds the limit.
+var ErrFrameTooLarge = errors.New("frame too large")
+
 func ReadFrame(r io.Reader) (*Frame, error) {
+	return ReadFrameMax(r, 0)
+}
+
+// ReadFrameMax reads a frame whose payload may be at most max bytes,
+// checking the header's length before allocating for the payload. A max
+// of zero disables the check.
+func ReadFrameMax(r io.Reader, max uint32) (*Frame, error) {
 	header := make([]byte, 9)
 	if _, err := io.ReadFull(r, header); err != nil {
 		return nil, err
@@ -31,6 +150,9 @@ func ReadFrame(r io.Reader) (*Frame, error) {
 		Length:   binary.BigEndian.Uint32(header[5:9]),
 	}
 
+	if max > 0 && f.Length > max {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d", ErrFrameTooLarge, f.Length, max)
+	}
 	if f.Length > 0 {
 		f.Payload = make([]byte, f.Length)
 		if _, err := io.ReadFull(r, f.Payload); err != nil {
@@ -2,6 +2,7 @@ package frame_test
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 
 	"srv/internal/transport/frame"
@@ -83,3 +84,40 @@ func TestStringify(t *testing.T) {
 		t.Errorf("Expected %q, got %q", expected, frame.Stringify(f))
 	}
 }
+
+func TestConnectMetaRoundTrip(t *testing.T) {
+	meta := frame.ConnectMeta{RemoteAddr: "203.0.113.7:51234", LocalAddr: "10.0.0.2:6502"}
+
+	got, err := frame.DecodeConnect(frame.EncodeConnect(meta))
+	if err != nil {
+		t.Fatalf("DecodeConnect failed: %v", err)
+	}
+	if got != meta {
+		t.Errorf("Expected %+v, got %+v", meta, got)
+	}
+}
+
+func TestDecodeConnectEmptyPayload(t *testing.T) {
+	got, err := frame.DecodeConnect(nil)
+	if err != nil {
+		t.Fatalf("Expected no error for empty payload: %v", err)
+	}
+	if got != (frame.ConnectMeta{}) {
+		t.Errorf("Expected zero meta, got %+v", got)
+	}
+}
+
+func TestReadFrameMaxRejectsOversizedHeader(t *testing.T) {
+	// a bare header announcing 4 GiB, with no payload behind it
+	header := []byte{frame.TypeHello, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}
+	if _, err := frame.ReadFrameMax(bytes.NewReader(header), 4096); !errors.Is(err, frame.ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+
+	buf := new(bytes.Buffer)
+	frame.WriteFrame(buf, &frame.Frame{Type: frame.TypeData, Length: 4, Payload: []byte("ping")})
+	f, err := frame.ReadFrameMax(buf, 4)
+	if err != nil || string(f.Payload) != "ping" {
+		t.Fatalf("expected a frame at the limit to be read, got %v", err)
+	}
+}
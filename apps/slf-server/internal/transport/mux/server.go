@@ -1,52 +1,223 @@
 package mux
 
 import (
+	"errors"
 	"io"
 	"log"
 	"math/rand"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"srv/internal/transport/frame"
+	"srv/internal/transport/shaper"
 )
 
+var ErrBusy = errors.New("mux: too many pending streams")
+
+// Dialer connects a stream opened by the internal client to its target.
+type Dialer func(open frame.OpenMeta) (net.Conn, error)
+
 type Server struct {
 	internal    net.Conn
-	internalMu   sync.Mutex
+	writeMu     sync.Mutex
 	streams     map[uint32]net.Conn
+	writers     map[uint32]*streamWriter // deliver frames to streams, see writer.go
+	datagrams   map[uint32]*udpStream
+	datagramOut chan outDatagram // to the UDP socket, see udp.go
+	dialer      Dialer
 	mu          sync.RWMutex
-	restarted    bool
 	newExternal chan net.Conn
 	quit        chan struct{}
+	stopOnce    sync.Once
+	up          *shaper.Limiter // CLI → external clients
+	down        *shaper.Limiter // external clients → CLI
+	bytesUp     atomic.Uint64
+	bytesDown   atomic.Uint64
+	unhealthy   atomic.Bool   // the internal client's local service is down
+	idle        time.Duration // close streams without traffic for this long
+	lifetime    time.Duration // close streams open for this long
 }
 
 func NewServer(internal net.Conn) *Server {
 	return &Server{
 		internal:    internal,
 		streams:     make(map[uint32]net.Conn),
+		writers:     make(map[uint32]*streamWriter),
+		datagrams:   make(map[uint32]*udpStream),
+		datagramOut: make(chan outDatagram, datagramQueue),
 		newExternal: make(chan net.Conn, 100),
 		quit:        make(chan struct{}),
 	}
 }
 
+// SetLimiters shapes the server's throughput. Limiters may be shared by
+// the servers of one session so the limit applies to all of them. Call
+// before Start.
+func (s *Server) SetLimiters(up, down *shaper.Limiter) {
+	s.up = up
+	s.down = down
+}
+
+// SetDialer enables OPEN frames from the internal client. Call before Start.
+func (s *Server) SetDialer(d Dialer) {
+	s.dialer = d
+}
+
+// Done is closed once the server has stopped, e.g. because the internal
+// client disconnected.
+func (s *Server) Done() <-chan struct{} {
+	return s.quit
+}
+
+// Streams returns the number of open streams.
+func (s *Server) Streams() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.streams) + len(s.datagrams)
+}
+
+// Healthy reports whether the internal client last reported its local
+// service as up. Clients that never report are healthy.
+func (s *Server) Healthy() bool {
+	return !s.unhealthy.Load()
+}
+
+// Usage returns the bytes carried in each direction so far.
+func (s *Server) Usage() (up, down uint64) {
+	return s.bytesUp.Load(), s.bytesDown.Load()
+}
+
 func (s *Server) Start() {
 	go s.handleInternalRead()
 	go s.handleExternalAccept()
+	if s.idle > 0 || s.lifetime > 0 {
+		go s.reapStreams()
+	}
+}
+
+// AddExternalConn queues conn as a new stream. It never blocks: when the
+// queue is full the connection is refused with ErrBusy.
+func (s *Server) AddExternalConn(conn net.Conn) error {
+	select {
+	case s.newExternal <- conn:
+		return nil
+	default:
+		return ErrBusy
+	}
 }
 
-func (s *Server) AddExternalConn(conn net.Conn) {
-	s.newExternal <- conn
+// OpenStream returns one end of an in-memory connection that is carried
+// to the internal client as a new stream.
+func (s *Server) OpenStream() (net.Conn, error) {
+	return s.OpenStreamWith(frame.ConnectMeta{})
 }
 
-func (s *Server) Stop() {
-	close(s.quit)
-	s.internal.Close()
-	s.mu.Lock()
-	for _, c := range s.streams {
-		c.Close()
+// metaConn carries CONNECT metadata for streams that have no real
+// external connection behind them.
+type metaConn struct {
+	net.Conn
+	meta   frame.ConnectMeta
+	closed *atomic.Pointer[StreamError] // shared with the streamConn end
+}
+
+// OpenStreamWith is OpenStream with explicit CONNECT metadata.
+func (s *Server) OpenStreamWith(meta frame.ConnectMeta) (net.Conn, error) {
+	local, remote := net.Pipe()
+	closed := new(atomic.Pointer[StreamError])
+	if err := s.AddExternalConn(&metaConn{Conn: remote, meta: meta, closed: closed}); err != nil {
+		local.Close()
+		remote.Close()
+		return nil, err
 	}
-	s.mu.Unlock()
-	log.Println("[mux] server stopped")
+	return &streamConn{Conn: local, closed: closed}, nil
+}
+
+// StreamError is returned by streams from OpenStream once the internal
+// client closed them with a reason, e.g. because its local service could
+// not be reached.
+type StreamError struct {
+	Reason string // frame.CloseRefused or frame.CloseTimeout
+	Detail string
+}
+
+func (e *StreamError) Error() string {
+	if e.Detail == "" {
+		return "stream closed by client: " + e.Reason
+	}
+	return "stream closed by client: " + e.Reason + ": " + e.Detail
+}
+
+// Timeout reports whether the local service did not answer in time, so
+// the error counts as a net.Error timeout.
+func (e *StreamError) Timeout() bool   { return e.Reason == frame.CloseTimeout }
+func (e *StreamError) Temporary() bool { return false }
+
+// streamConn is the local end of an in-memory stream. It fails with the
+// client's StreamError instead of io.EOF when one was given.
+type streamConn struct {
+	net.Conn
+	closed *atomic.Pointer[StreamError]
+}
+
+func (c *streamConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err == io.EOF {
+		if e := c.closed.Load(); e != nil {
+			return n, e
+		}
+	}
+	return n, err
+}
+
+func (c *streamConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if errors.Is(err, io.ErrClosedPipe) {
+		if e := c.closed.Load(); e != nil {
+			return n, e
+		}
+	}
+	return n, err
+}
+
+// setCloseReason records why the internal client closed an in-memory
+// stream, before its pipe is closed.
+func setCloseReason(conn net.Conn, payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+	if w, ok := conn.(*watchedConn); ok {
+		conn = w.Conn
+	}
+	mc, ok := conn.(*metaConn)
+	if !ok || mc.closed == nil {
+		return
+	}
+	meta, err := frame.DecodeClose(payload)
+	if err != nil || meta.Reason == "" {
+		return
+	}
+	mc.closed.Store(&StreamError{Reason: meta.Reason, Detail: meta.Detail})
+}
+
+func (s *Server) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.quit)
+		s.internal.Close()
+		s.mu.Lock()
+		for _, c := range s.streams {
+			c.Close()
+		}
+		for _, w := range s.writers {
+			w.stop()
+		}
+		for _, d := range s.datagrams {
+			d.release()
+		}
+		s.mu.Unlock()
+		log.Println("[mux] server stopped")
+	})
 }
 
 func (s *Server) handleExternalAccept() {
@@ -55,6 +226,15 @@ func (s *Server) handleExternalAccept() {
 		case <-s.quit:
 			return
 		case conn := <-s.newExternal:
+			connectMeta := frame.ConnectMeta{
+				RemoteAddr: addrString(conn.RemoteAddr()),
+				LocalAddr:  addrString(conn.LocalAddr()),
+			}
+			if mc, ok := conn.(*metaConn); ok {
+				connectMeta = mc.meta
+			}
+			conn = s.watch(conn)
+
 			streamID := rand.Uint32()
 			s.mu.Lock()
 			s.streams[streamID] = conn
@@ -62,9 +242,12 @@ func (s *Server) handleExternalAccept() {
 
 			log.Printf("[mux] accepted external streamID=%d", streamID)
 
-			err := frame.WriteFrame(s.internal, &frame.Frame{
+			meta := frame.EncodeConnect(connectMeta)
+			err := s.writeFrame(&frame.Frame{
 				Type:     frame.TypeConnect,
 				StreamID: streamID,
+				Length:   uint32(len(meta)),
+				Payload:  meta,
 			})
 			if err != nil {
 				log.Printf("[mux] failed to write CONNECT frame: %v", err)
@@ -75,10 +258,25 @@ func (s *Server) handleExternalAccept() {
 	}
 }
 
+// writeFrame serializes writers so frames never interleave on the wire.
+func (s *Server) writeFrame(f *frame.Frame) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return frame.WriteFrame(s.internal, f)
+}
+
+// addrString skips in-memory addresses, which mean nothing to the client.
+func addrString(addr net.Addr) string {
+	if addr == nil || addr.Network() == "pipe" {
+		return ""
+	}
+	return addr.String()
+}
+
 func (s *Server) pipeToInternal(streamID uint32, conn net.Conn) {
 	pr, pw := net.Pipe()
 	go func() {
-		_, err := io.Copy(pw, conn)
+		_, err := io.Copy(pw, shaper.NewReader(conn, s.down))
 		pw.Close()
 		if err != nil {
 			log.Printf("[mux] io.Copy error for stream %d: %v", streamID, err)
@@ -91,7 +289,7 @@ func (s *Server) pipeToInternal(streamID uint32, conn net.Conn) {
 		if err != nil {
 			break
 		}
-		err = frame.WriteFrame(s.internal, &frame.Frame{
+		err = s.writeFrame(&frame.Frame{
 			Type:     frame.TypeData,
 			StreamID: streamID,
 			Length:   uint32(n),
@@ -101,10 +299,11 @@ func (s *Server) pipeToInternal(streamID uint32, conn net.Conn) {
 			log.Printf("[mux] failed to write frame for stream %d: %v", streamID, err)
 			break
 		}
+		s.bytesDown.Add(uint64(n))
 		log.Printf("[mux] wrote %d bytes from external to internal for stream %d", n, streamID)
 	}
 
-	err := frame.WriteFrame(s.internal, &frame.Frame{
+	err := s.writeFrame(&frame.Frame{
 		Type:     frame.TypeClose,
 		StreamID: streamID,
 	})
@@ -115,6 +314,7 @@ func (s *Server) pipeToInternal(streamID uint32, conn net.Conn) {
 	s.mu.Lock()
 	delete(s.streams, streamID)
 	s.mu.Unlock()
+	s.removeWriter(streamID)
 	conn.Close()
 }
 
@@ -134,47 +334,71 @@ func (s *Server) handleInternalRead() {
 
 			log.Printf("[mux] got frame: type=%d streamID=%d length=%d", f.Type, f.StreamID, f.Length)
 
-			s.mu.RLock()
-			conn, ok := s.streams[f.StreamID]
-			s.mu.RUnlock()
-
-			if !ok {
-				log.Printf("[mux] unknown stream id %d", f.StreamID)
+			if f.Type == frame.TypeOpen {
+				go s.handleOpen(f)
+				continue
+			}
+			if f.Type == frame.TypeHealth {
+				s.handleHealth(f)
+				continue
+			}
+			if f.Type == frame.TypePing {
+				// answered off the read loop, the client may be slow to read
+				go s.writeFrame(&frame.Frame{Type: frame.TypePong, Length: f.Length, Payload: f.Payload})
+				continue
+			}
+			if s.handleDatagramFrame(f) {
 				continue
 			}
 
-			switch f.Type {
-			case frame.TypeData:
-				n, err := conn.Write(f.Payload)
-				if err != nil {
-					log.Printf("[mux] stream %d write to external failed: %v", f.StreamID, err)
-				} else {
-					log.Printf("[mux] wrote %d bytes to stream %d", n, f.StreamID)
-				}
-			case frame.TypeClose:
-				s.mu.Lock()
-				delete(s.streams, f.StreamID)
-				s.mu.Unlock()
-				conn.Close()
-				log.Printf("[mux] stream %d closed by internal", f.StreamID)
+			if f.Type == frame.TypeData || f.Type == frame.TypeClose {
+				s.enqueue(f)
 			}
 		}
 	}
 }
 
+// handleOpen dials the target of a stream opened by the internal client
+// and acks it with a CONNECT frame, or refuses it with CLOSE.
+func (s *Server) handleOpen(f *frame.Frame) {
+	meta, err := frame.DecodeOpen(f.Payload)
+	if err != nil || s.dialer == nil {
+		log.Printf("[mux] refusing OPEN for stream %d: invalid request or forwarding disabled", f.StreamID)
+		_ = s.writeFrame(&frame.Frame{Type: frame.TypeClose, StreamID: f.StreamID})
+		return
+	}
 
-func (s *Server) SetInternalConn(conn net.Conn) {
-	s.internalMu.Lock()
-	defer s.internalMu.Unlock()
+	conn, err := s.dialer(meta)
+	if err != nil {
+		log.Printf("[mux] OPEN stream %d to %s failed: %v", f.StreamID, meta.Target, err)
+		_ = s.writeFrame(&frame.Frame{Type: frame.TypeClose, StreamID: f.StreamID})
+		return
+	}
+	conn = s.watch(conn)
 
-	if s.internal != nil {
-		log.Println("[mux] closing old internal connection")
-		s.internal.Close()
+	s.mu.Lock()
+	s.streams[f.StreamID] = conn
+	s.mu.Unlock()
+
+	if err := s.writeFrame(&frame.Frame{Type: frame.TypeConnect, StreamID: f.StreamID}); err != nil {
+		log.Printf("[mux] failed to ack OPEN for stream %d: %v", f.StreamID, err)
 	}
+	log.Printf("[mux] opened stream %d to %s", f.StreamID, meta.Target)
 
-	s.internal = conn
-	s.restarted = true
+	s.pipeToInternal(f.StreamID, conn)
+}
 
-	log.Println("[mux] internal connection reset, restarting handler")
-	go s.handleInternalRead()
-}
\ No newline at end of file
+func (s *Server) handleHealth(f *frame.Frame) {
+	meta, err := frame.DecodeHealth(f.Payload)
+	if err != nil {
+		log.Printf("[mux] invalid HEALTH frame: %v", err)
+		return
+	}
+	if was := s.unhealthy.Swap(!meta.Healthy); was == meta.Healthy {
+		if meta.Healthy {
+			log.Println("[mux] local service is healthy again")
+		} else {
+			log.Printf("[mux] local service is unhealthy: %s", meta.Detail)
+		}
+	}
+}
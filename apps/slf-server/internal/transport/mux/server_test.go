@@ -10,6 +10,7 @@ import (
 
 	"srv/internal/transport/frame"
 	"srv/internal/transport/mux"
+	"srv/internal/transport/shaper"
 )
 
 type mockConn struct {
@@ -49,25 +50,6 @@ func TestServerAddExternalConn(t *testing.T) {
 	}
 }
 
-func TestServerSetInternalConn(t *testing.T) {
-	r1, w1 := io.Pipe()
-	conn1 := &mockConn{Reader: r1, Writer: io.Discard}
-
-	server := mux.NewServer(conn1)
-	server.Start()
-
-	r2, w2 := io.Pipe()
-	conn2 := &mockConn{Reader: r2, Writer: io.Discard}
-	server.SetInternalConn(conn2)
-
-	if server == nil {
-		t.Fatal("server should not be nil")
-	}
-
-	_ = w1.Close()
-	_ = w2.Close()
-}
-
 func TestFrameWriteAndRead(t *testing.T) {
 	var buf bytes.Buffer
 
@@ -91,3 +73,300 @@ func TestFrameWriteAndRead(t *testing.T) {
 		t.Errorf("frame mismatch: got %+v, want %+v", out, f)
 	}
 }
+
+func TestServerUDPRelay(t *testing.T) {
+	internal, client := net.Pipe()
+	server := mux.NewServer(internal)
+	server.Start()
+	defer server.Stop()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen udp: %v", err)
+	}
+	go server.ServeUDP(pc, time.Minute, nil)
+
+	remote, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to dial udp: %v", err)
+	}
+	defer remote.Close()
+	remote.Write([]byte("ping"))
+
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	connect, err := frame.ReadFrame(client)
+	if err != nil {
+		t.Fatalf("failed to read CONNECT frame: %v", err)
+	}
+	meta, _ := frame.DecodeConnect(connect.Payload)
+	if connect.Type != frame.TypeConnect || meta.Protocol != "udp" {
+		t.Fatalf("expected udp CONNECT frame, got %s %+v", frame.Stringify(connect), meta)
+	}
+
+	data, err := frame.ReadFrame(client)
+	if err != nil {
+		t.Fatalf("failed to read DATAGRAM frame: %v", err)
+	}
+	if data.Type != frame.TypeDatagram || data.StreamID != connect.StreamID || string(data.Payload) != "ping" {
+		t.Fatalf("unexpected frame %s payload=%q", frame.Stringify(data), data.Payload)
+	}
+
+	frame.WriteFrame(client, &frame.Frame{
+		Type:     frame.TypeDatagram,
+		StreamID: connect.StreamID,
+		Length:   4,
+		Payload:  []byte("pong"),
+	})
+
+	remote.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 16)
+	n, err := remote.Read(buf)
+	if err != nil || string(buf[:n]) != "pong" {
+		t.Fatalf("expected pong, got %q (%v)", buf[:n], err)
+	}
+}
+
+func TestServerUDPHandsOffOnStop(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen udp: %v", err)
+	}
+	defer pc.Close()
+
+	internal1, _ := net.Pipe()
+	first := mux.NewServer(internal1)
+	first.Start()
+	served := make(chan error, 1)
+	go func() { served <- first.ServeUDP(pc, time.Minute, nil) }()
+
+	first.Stop()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("expected nil after stop, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeUDP did not return after the server stopped")
+	}
+
+	internal2, client := net.Pipe()
+	second := mux.NewServer(internal2)
+	second.Start()
+	defer second.Stop()
+	go second.ServeUDP(pc, time.Minute, nil)
+
+	remote, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to dial udp: %v", err)
+	}
+	defer remote.Close()
+	remote.Write([]byte("ping"))
+
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	connect, err := frame.ReadFrame(client)
+	if err != nil || connect.Type != frame.TypeConnect {
+		t.Fatalf("expected CONNECT on the second agent, got %v", err)
+	}
+}
+
+func TestServerShapedDatagramsDoNotStallReads(t *testing.T) {
+	internal, client := net.Pipe()
+	server := mux.NewServer(internal)
+	server.SetLimiters(shaper.NewLimiter(10), nil) // 10 bytes per second up
+	server.Start()
+	defer server.Stop()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen udp: %v", err)
+	}
+	defer pc.Close()
+	go server.ServeUDP(pc, time.Minute, nil)
+
+	remote, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to dial udp: %v", err)
+	}
+	defer remote.Close()
+	remote.Write([]byte("ping"))
+
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	connect, err := frame.ReadFrame(client)
+	if err != nil {
+		t.Fatalf("failed to read CONNECT frame: %v", err)
+	}
+	go func() {
+		for {
+			if _, err := frame.ReadFrame(client); err != nil {
+				return
+			}
+		}
+	}()
+
+	// shaping 1000 bytes at 10 bytes per second takes well over a minute
+	big := make([]byte, 1000)
+	for i := 0; i < 3; i++ {
+		frame.WriteFrame(client, &frame.Frame{Type: frame.TypeDatagram, StreamID: connect.StreamID, Length: uint32(len(big)), Payload: big})
+	}
+	health := frame.EncodeHealth(frame.HealthMeta{Healthy: false})
+	if err := frame.WriteFrame(client, &frame.Frame{Type: frame.TypeHealth, Length: uint32(len(health)), Payload: health}); err != nil {
+		t.Fatalf("HEALTH frame not read behind shaped datagrams: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for server.Healthy() {
+		if time.Now().After(deadline) {
+			t.Fatal("HEALTH frame stuck behind shaped datagrams")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerSlowStreamDoesNotStallOthers(t *testing.T) {
+	internal, client := net.Pipe()
+	server := mux.NewServer(internal)
+	server.Start()
+	defer server.Stop()
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// nobody reads from stalled, so writes to it block
+	stalled, _ := net.Pipe()
+	server.AddExternalConn(stalled)
+	first, err := frame.ReadFrame(client)
+	if err != nil {
+		t.Fatalf("failed to read CONNECT: %v", err)
+	}
+
+	fast, fastPeer := net.Pipe()
+	server.AddExternalConn(fast)
+	second, err := frame.ReadFrame(client)
+	if err != nil {
+		t.Fatalf("failed to read CONNECT: %v", err)
+	}
+
+	go func() {
+		frame.WriteFrame(client, &frame.Frame{Type: frame.TypeData, StreamID: first.StreamID, Length: 4, Payload: []byte("slow")})
+		frame.WriteFrame(client, &frame.Frame{Type: frame.TypeData, StreamID: second.StreamID, Length: 4, Payload: []byte("fast")})
+		health := frame.EncodeHealth(frame.HealthMeta{Healthy: false})
+		frame.WriteFrame(client, &frame.Frame{Type: frame.TypeHealth, Length: uint32(len(health)), Payload: health})
+	}()
+
+	fastPeer.SetDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(fastPeer, buf); err != nil || string(buf) != "fast" {
+		t.Fatalf("expected data on the fast stream, got %q (%v)", buf, err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for server.Healthy() {
+		if time.Now().After(deadline) {
+			t.Fatal("HEALTH frame stuck behind a slow stream")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerOpenStream(t *testing.T) {
+	internal, client := net.Pipe()
+	server := mux.NewServer(internal)
+
+	targetSide, dialed := net.Pipe()
+	server.SetDialer(func(open frame.OpenMeta) (net.Conn, error) {
+		if open.Target != "db:5432" {
+			t.Errorf("unexpected target %q", open.Target)
+		}
+		return dialed, nil
+	})
+	server.Start()
+	defer server.Stop()
+
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	open := frame.EncodeOpen(frame.OpenMeta{Target: "db:5432"})
+	frame.WriteFrame(client, &frame.Frame{Type: frame.TypeOpen, StreamID: 7, Length: uint32(len(open)), Payload: open})
+
+	ack, err := frame.ReadFrame(client)
+	if err != nil {
+		t.Fatalf("failed to read ack: %v", err)
+	}
+	if ack.Type != frame.TypeConnect || ack.StreamID != 7 {
+		t.Fatalf("expected CONNECT ack for stream 7, got %s", frame.Stringify(ack))
+	}
+
+	go frame.WriteFrame(client, &frame.Frame{Type: frame.TypeData, StreamID: 7, Length: 5, Payload: []byte("hello")})
+	targetSide.SetDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(targetSide, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("expected hello at target, got %q (%v)", buf, err)
+	}
+}
+
+func TestServerOpenWithoutDialer(t *testing.T) {
+	internal, client := net.Pipe()
+	server := mux.NewServer(internal)
+	server.Start()
+	defer server.Stop()
+
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	open := frame.EncodeOpen(frame.OpenMeta{Target: "db:5432"})
+	frame.WriteFrame(client, &frame.Frame{Type: frame.TypeOpen, StreamID: 9, Length: uint32(len(open)), Payload: open})
+
+	f, err := frame.ReadFrame(client)
+	if err != nil {
+		t.Fatalf("failed to read reply: %v", err)
+	}
+	if f.Type != frame.TypeClose || f.StreamID != 9 {
+		t.Fatalf("expected CLOSE for stream 9, got %s", frame.Stringify(f))
+	}
+}
+
+func TestServerClosesIdleStreams(t *testing.T) {
+	internal, client := net.Pipe()
+	server := mux.NewServer(internal)
+	server.SetTimeouts(500*time.Millisecond, 0)
+	server.Start()
+	defer server.Stop()
+
+	external, peer := net.Pipe()
+	if err := server.AddExternalConn(external); err != nil {
+		t.Fatalf("failed to add external conn: %v", err)
+	}
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	connect, err := frame.ReadFrame(client)
+	if err != nil || connect.Type != frame.TypeConnect {
+		t.Fatalf("expected CONNECT, got %v (%v)", connect, err)
+	}
+
+	start := time.Now()
+	f, err := frame.ReadFrame(client)
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if f.Type != frame.TypeClose || f.StreamID != connect.StreamID {
+		t.Fatalf("expected CLOSE for the idle stream, got %s", frame.Stringify(f))
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("stream closed after %s, before its idle timeout", elapsed)
+	}
+
+	peer.SetDeadline(time.Now().Add(time.Second))
+	if _, err := peer.Read(make([]byte, 1)); err == nil {
+		t.Error("expected the external connection to be closed")
+	}
+}
+
+func TestServerAnswersPing(t *testing.T) {
+	internal, client := net.Pipe()
+	server := mux.NewServer(internal)
+	server.Start()
+	defer server.Stop()
+
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	go frame.WriteFrame(client, &frame.Frame{Type: frame.TypePing, Length: 8, Payload: []byte("12345678")})
+
+	f, err := frame.ReadFrame(client)
+	if err != nil {
+		t.Fatalf("failed to read PONG: %v", err)
+	}
+	if f.Type != frame.TypePong || f.StreamID != 0 || string(f.Payload) != "12345678" {
+		t.Fatalf("expected PONG echoing the payload, got %s %q", frame.Stringify(f), f.Payload)
+	}
+}
@@ -0,0 +1,87 @@
+package mux
+
+import (
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// reapInterval is how often streams are checked against their timeouts.
+const reapInterval = time.Second
+
+// watchedConn records when a stream was opened and last carried data.
+type watchedConn struct {
+	net.Conn
+	opened time.Time
+	last   atomic.Int64 // unix nanoseconds
+}
+
+func (c *watchedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.last.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+func (c *watchedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.last.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// SetTimeouts closes streams that carry no data for idle or stay open
+// longer than lifetime. Zero disables either. Call before Start.
+func (s *Server) SetTimeouts(idle, lifetime time.Duration) {
+	s.idle = idle
+	s.lifetime = lifetime
+}
+
+// watch wraps a new stream's connection when timeouts apply to it.
+func (s *Server) watch(conn net.Conn) net.Conn {
+	if s.idle <= 0 && s.lifetime <= 0 {
+		return conn
+	}
+	now := time.Now()
+	w := &watchedConn{Conn: conn, opened: now}
+	w.last.Store(now.UnixNano())
+	return w
+}
+
+// reapStreams closes streams past their timeouts until the server stops.
+// Closing the connection ends the stream like a client hang-up would.
+func (s *Server) reapStreams() {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case now := <-ticker.C:
+			s.mu.RLock()
+			var expired []net.Conn
+			for id, conn := range s.streams {
+				w, ok := conn.(*watchedConn)
+				if !ok {
+					continue
+				}
+				switch {
+				case s.lifetime > 0 && now.Sub(w.opened) >= s.lifetime:
+					log.Printf("[mux] stream %d reached its max lifetime of %s", id, s.lifetime)
+				case s.idle > 0 && now.Sub(time.Unix(0, w.last.Load())) >= s.idle:
+					log.Printf("[mux] stream %d idle for %s, closing", id, s.idle)
+				default:
+					continue
+				}
+				expired = append(expired, w)
+			}
+			s.mu.RUnlock()
+			for _, conn := range expired {
+				conn.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package mux
+
+import (
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"srv/internal/transport/frame"
+)
+
+const maxDatagramSize = 65535
+
+// datagramQueue is how many datagrams from the internal client may wait
+// for the UDP socket. Datagrams arriving while it is full are dropped.
+const datagramQueue = 256
+
+// outDatagram is a datagram on its way to a remote address.
+type outDatagram struct {
+	payload []byte
+	addr    net.Addr
+}
+
+// Admit decides whether a new remote address may open a datagram stream.
+// On success the returned release func is called when the stream expires.
+type Admit func(addr net.Addr) (release func(), ok bool)
+
+// udpStream is the virtual stream of one remote UDP address.
+type udpStream struct {
+	id      uint32
+	addr    net.Addr
+	last    time.Time
+	release func()
+}
+
+// ServeUDP relays datagrams arriving on pc to the internal client, one
+// virtual stream per remote address. Streams idle for longer than idle are
+// closed. It returns nil once the server stops, leaving pc open for
+// another agent to serve, or the error that ended reads from pc.
+func (s *Server) ServeUDP(pc net.PacketConn, idle time.Duration, admit Admit) error {
+	byAddr := make(map[string]*udpStream)
+	var mu sync.Mutex
+
+	go s.expireDatagrams(pc, byAddr, &mu, idle)
+	go s.writeDatagrams(pc)
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-s.quit:
+				_ = pc.SetReadDeadline(time.Time{})
+				return nil
+			default:
+			}
+			log.Printf("[mux] udp read stopped: %v", err)
+			return err
+		}
+
+		mu.Lock()
+		st, ok := byAddr[addr.String()]
+		if !ok || !s.datagramOpen(st.id) {
+			st = s.openDatagramStream(pc, addr, admit)
+			if st != nil {
+				byAddr[addr.String()] = st
+			}
+		}
+		if st != nil {
+			st.last = time.Now()
+		}
+		mu.Unlock()
+		if st == nil {
+			continue
+		}
+
+		s.down.WaitN(n)
+		err = s.writeFrame(&frame.Frame{
+			Type:     frame.TypeDatagram,
+			StreamID: st.id,
+			Length:   uint32(n),
+			Payload:  buf[:n],
+		})
+		if err != nil {
+			log.Printf("[mux] failed to write DATAGRAM frame for stream %d: %v", st.id, err)
+			continue
+		}
+		s.bytesDown.Add(uint64(n))
+	}
+}
+
+func (s *Server) openDatagramStream(pc net.PacketConn, addr net.Addr, admit Admit) *udpStream {
+	release := func() {}
+	if admit != nil {
+		var ok bool
+		if release, ok = admit(addr); !ok {
+			return nil
+		}
+	}
+
+	st := &udpStream{id: rand.Uint32(), addr: addr, release: release}
+	s.mu.Lock()
+	s.datagrams[st.id] = st
+	s.mu.Unlock()
+
+	meta := frame.EncodeConnect(frame.ConnectMeta{
+		RemoteAddr: addr.String(),
+		LocalAddr:  addrString(pc.LocalAddr()),
+		Protocol:   "udp",
+	})
+	err := s.writeFrame(&frame.Frame{
+		Type:     frame.TypeConnect,
+		StreamID: st.id,
+		Length:   uint32(len(meta)),
+		Payload:  meta,
+	})
+	if err != nil {
+		log.Printf("[mux] failed to write CONNECT frame: %v", err)
+	}
+
+	log.Printf("[mux] opened udp streamID=%d for %s", st.id, addr)
+	return st
+}
+
+func (s *Server) expireDatagrams(pc net.PacketConn, byAddr map[string]*udpStream, mu *sync.Mutex, idle time.Duration) {
+	ticker := time.NewTicker(idle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			// unblock ServeUDP without closing pc
+			_ = pc.SetReadDeadline(time.Now())
+			return
+		case now := <-ticker.C:
+			mu.Lock()
+			for key, st := range byAddr {
+				open := s.datagramOpen(st.id)
+				if open && now.Sub(st.last) < idle {
+					continue
+				}
+				delete(byAddr, key)
+				if open {
+					s.closeDatagramStream(st.id)
+					_ = s.writeFrame(&frame.Frame{Type: frame.TypeClose, StreamID: st.id})
+					log.Printf("[mux] udp stream %d expired", st.id)
+				}
+			}
+			mu.Unlock()
+		}
+	}
+}
+
+func (s *Server) datagramOpen(id uint32) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.datagrams[id]
+	return ok
+}
+
+func (s *Server) closeDatagramStream(id uint32) {
+	s.mu.Lock()
+	st, ok := s.datagrams[id]
+	delete(s.datagrams, id)
+	s.mu.Unlock()
+	if ok {
+		st.release()
+	}
+}
+
+// handleDatagramFrame handles frames for datagram streams and reports
+// whether the frame belonged to one.
+func (s *Server) handleDatagramFrame(f *frame.Frame) bool {
+	s.mu.RLock()
+	st, ok := s.datagrams[f.StreamID]
+	s.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	switch f.Type {
+	case frame.TypeDatagram:
+		select {
+		case s.datagramOut <- outDatagram{payload: f.Payload, addr: st.addr}:
+		default:
+			log.Printf("[mux] udp stream %d: socket is not keeping up, dropping datagram", f.StreamID)
+		}
+	case frame.TypeClose:
+		s.closeDatagramStream(f.StreamID)
+		log.Printf("[mux] udp stream %d closed by internal", f.StreamID)
+	}
+	return true
+}
+
+// writeDatagrams shapes and sends the internal client's datagrams on its
+// own goroutine, so a throttled UDP session never stalls the internal read
+// loop.
+func (s *Server) writeDatagrams(pc net.PacketConn) {
+	for {
+		select {
+		case <-s.quit:
+			return
+		case d := <-s.datagramOut:
+			s.up.WaitN(len(d.payload))
+			if _, err := pc.WriteTo(d.payload, d.addr); err != nil {
+				log.Printf("[mux] udp write to %s failed: %v", d.addr, err)
+				continue
+			}
+			s.bytesUp.Add(uint64(len(d.payload)))
+		}
+	}
+}
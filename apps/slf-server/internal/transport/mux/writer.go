@@ -0,0 +1,95 @@
+package mux
+
+import (
+	"log"
+	"net"
+	"sync"
+
+	"srv/internal/transport/frame"
+	"srv/internal/transport/shaper"
+)
+
+// streamQueue is how many frames may wait for one external connection
+// before the stream is reset as too slow.
+const streamQueue = 256
+
+// streamWriter delivers the internal client's frames for one stream on its
+// own goroutine, so a slow external client or a shaped stream never stalls
+// the internal read loop and with it every other stream and HEALTH frame.
+type streamWriter struct {
+	conn   net.Conn
+	frames chan *frame.Frame // DATA, then at most one CLOSE
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (w *streamWriter) stop() {
+	w.once.Do(func() { close(w.done) })
+}
+
+// enqueue hands a DATA or CLOSE frame to its stream's writer, starting one
+// for the stream's first frame. A CLOSE is applied after the data queued
+// before it.
+func (s *Server) enqueue(f *frame.Frame) {
+	s.mu.Lock()
+	conn, ok := s.streams[f.StreamID]
+	if !ok {
+		s.mu.Unlock()
+		log.Printf("[mux] unknown stream id %d", f.StreamID)
+		return
+	}
+	if f.Type == frame.TypeClose {
+		delete(s.streams, f.StreamID)
+	}
+	w, ok := s.writers[f.StreamID]
+	if !ok {
+		w = &streamWriter{conn: conn, frames: make(chan *frame.Frame, streamQueue), done: make(chan struct{})}
+		s.writers[f.StreamID] = w
+		go s.runWriter(f.StreamID, w)
+	}
+	s.mu.Unlock()
+
+	select {
+	case w.frames <- f:
+	default:
+		log.Printf("[mux] stream %d: external side is not keeping up, resetting it", f.StreamID)
+		s.removeWriter(f.StreamID)
+		conn.Close()
+	}
+}
+
+func (s *Server) runWriter(streamID uint32, w *streamWriter) {
+	for {
+		select {
+		case <-w.done:
+			return
+		case f := <-w.frames:
+			if f.Type == frame.TypeClose {
+				s.removeWriter(streamID)
+				setCloseReason(w.conn, f.Payload)
+				w.conn.Close()
+				log.Printf("[mux] stream %d closed by internal", streamID)
+				return
+			}
+			n, err := shaper.NewWriter(w.conn, s.up).Write(f.Payload)
+			s.bytesUp.Add(uint64(n))
+			if err != nil {
+				log.Printf("[mux] stream %d write to external failed: %v", streamID, err)
+			} else {
+				log.Printf("[mux] wrote %d bytes to stream %d", n, streamID)
+			}
+		}
+	}
+}
+
+// removeWriter stops a stream's writer, dropping frames it has not
+// written yet.
+func (s *Server) removeWriter(streamID uint32) {
+	s.mu.Lock()
+	w, ok := s.writers[streamID]
+	delete(s.writers, streamID)
+	s.mu.Unlock()
+	if ok {
+		w.stop()
+	}
+}
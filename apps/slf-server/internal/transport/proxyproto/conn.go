@@ -0,0 +1,136 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var ErrNoHeader = errors.New("proxyproto: missing PROXY protocol header")
+
+// Conn is a connection whose addresses come from a PROXY protocol header.
+type Conn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+	local  net.Addr
+}
+
+func (c *Conn) Read(b []byte) (int, error) { return c.r.Read(b) }
+func (c *Conn) RemoteAddr() net.Addr       { return c.remote }
+func (c *Conn) LocalAddr() net.Addr        { return c.local }
+
+// Read consumes a v1 or v2 PROXY protocol header from conn. Connections
+// without a header are rejected; UNKNOWN and LOCAL headers keep the
+// addresses of the underlying connection.
+func Read(conn net.Conn, timeout time.Duration) (*Conn, error) {
+	c := &Conn{
+		Conn:   conn,
+		r:      bufio.NewReader(conn),
+		remote: conn.RemoteAddr(),
+		local:  conn.LocalAddr(),
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	if sig, err := c.r.Peek(len(v2Signature)); err == nil && bytes.Equal(sig, v2Signature) {
+		return c, c.readV2()
+	}
+	if prefix, err := c.r.Peek(6); err == nil && string(prefix) == "PROXY " {
+		return c, c.readV1()
+	}
+	return nil, ErrNoHeader
+}
+
+func (c *Conn) readV1() error {
+	var line []byte
+	for len(line) < 107 {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return fmt.Errorf("proxyproto: malformed v1 header")
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return fmt.Errorf("proxyproto: malformed v1 header %q", strings.TrimSpace(string(line)))
+	}
+
+	src, err := tcpAddr(fields[2], fields[4])
+	if err != nil {
+		return err
+	}
+	dst, err := tcpAddr(fields[3], fields[5])
+	if err != nil {
+		return err
+	}
+	c.remote, c.local = src, dst
+	return nil
+}
+
+func (c *Conn) readV2() error {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return err
+	}
+	if header[12]>>4 != 2 {
+		return fmt.Errorf("proxyproto: unsupported v2 version %d", header[12]>>4)
+	}
+
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return err
+	}
+
+	if header[12]&0x0f == 0x0 { // LOCAL, e.g. balancer health checks
+		return nil
+	}
+
+	switch header[13] {
+	case 0x11: // TCP over IPv4
+		if len(body) < 12 {
+			return fmt.Errorf("proxyproto: short v2 IPv4 address block")
+		}
+		c.remote = &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}
+		c.local = &net.TCPAddr{IP: net.IP(body[4:8]), Port: int(binary.BigEndian.Uint16(body[10:12]))}
+	case 0x21: // TCP over IPv6
+		if len(body) < 36 {
+			return fmt.Errorf("proxyproto: short v2 IPv6 address block")
+		}
+		c.remote = &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}
+		c.local = &net.TCPAddr{IP: net.IP(body[16:32]), Port: int(binary.BigEndian.Uint16(body[34:36]))}
+	}
+	return nil
+}
+
+func tcpAddr(ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("proxyproto: invalid address %q", ip)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 0 || p > 65535 {
+		return nil, fmt.Errorf("proxyproto: invalid port %q", port)
+	}
+	return &net.TCPAddr{IP: addr, Port: p}, nil
+}
@@ -0,0 +1,72 @@
+package proxyproto_test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"srv/internal/transport/proxyproto"
+)
+
+func readWith(t *testing.T, preamble []byte) (*proxyproto.Conn, error) {
+	t.Helper()
+	client, server := net.Pipe()
+	go func() {
+		client.Write(preamble)
+		client.Write([]byte("hello"))
+		client.Close()
+	}()
+	return proxyproto.Read(server, time.Second)
+}
+
+func TestReadV1(t *testing.T) {
+	c, err := readWith(t, []byte("PROXY TCP4 203.0.113.7 10.0.0.2 51234 6502\r\n"))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if c.RemoteAddr().String() != "203.0.113.7:51234" || c.LocalAddr().String() != "10.0.0.2:6502" {
+		t.Errorf("unexpected addresses remote=%s local=%s", c.RemoteAddr(), c.LocalAddr())
+	}
+
+	rest, _ := io.ReadAll(c)
+	if string(rest) != "hello" {
+		t.Errorf("expected payload after header, got %q", rest)
+	}
+}
+
+func TestReadV2(t *testing.T) {
+	header := []byte("\r\n\r\n\x00\r\nQUIT\n")
+	header = append(header, 0x21, 0x11, 0x00, 0x0c)
+	header = append(header, 203, 0, 113, 7, 10, 0, 0, 2, 0xc8, 0x22, 0x19, 0x66)
+
+	c, err := readWith(t, header)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if c.RemoteAddr().String() != "203.0.113.7:51234" || c.LocalAddr().String() != "10.0.0.2:6502" {
+		t.Errorf("unexpected addresses remote=%s local=%s", c.RemoteAddr(), c.LocalAddr())
+	}
+
+	rest, _ := io.ReadAll(c)
+	if string(rest) != "hello" {
+		t.Errorf("expected payload after header, got %q", rest)
+	}
+}
+
+func TestReadV1Unknown(t *testing.T) {
+	c, err := readWith(t, []byte("PROXY UNKNOWN\r\n"))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if c.RemoteAddr().Network() != "pipe" {
+		t.Errorf("expected original address for UNKNOWN, got %s", c.RemoteAddr())
+	}
+}
+
+func TestReadWithoutHeader(t *testing.T) {
+	_, err := readWith(t, []byte("GET / HTTP/1.1\r\n\r\n"))
+	if err == nil {
+		t.Fatal("expected error for connection without PROXY header")
+	}
+}
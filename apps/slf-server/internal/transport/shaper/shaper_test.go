@@ -0,0 +1,41 @@
+package shaper_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"srv/internal/transport/shaper"
+)
+
+func TestLimiterThrottlesWrites(t *testing.T) {
+	l := shaper.NewLimiter(1000)
+	w := shaper.NewWriter(io.Discard, l)
+
+	start := time.Now()
+	w.Write(make([]byte, 1000)) // burst
+	w.Write(make([]byte, 500))
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("expected writes over the burst to be delayed, took %v", elapsed)
+	}
+}
+
+func TestReaderPassesData(t *testing.T) {
+	r := shaper.NewReader(bytes.NewReader([]byte("hello")), shaper.NewLimiter(1<<20))
+	got, err := io.ReadAll(r)
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("expected hello, got %q (%v)", got, err)
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	if shaper.NewLimiter(0) != nil {
+		t.Fatal("expected nil limiter for zero rate")
+	}
+
+	var buf bytes.Buffer
+	if w := shaper.NewWriter(&buf, nil); w != &buf {
+		t.Error("expected writer to be returned unwrapped")
+	}
+}
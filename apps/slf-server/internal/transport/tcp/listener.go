@@ -10,19 +10,25 @@ import (
 
 type Handler func(extConn net.Conn, intConn net.Conn)
 
+// defaultPairTimeout is how long an external connection waits for an
+// internal one to be paired with.
+const defaultPairTimeout = 10 * time.Second
+
 type TCPProxy struct {
-	ExtPort int
-	IntPort int
-	ext     net.Listener
-	intl    net.Listener
-	quit    chan struct{}
+	ExtPort     int
+	IntPort     int
+	PairTimeout time.Duration // defaultPairTimeout when zero
+	ext         net.Listener
+	intl        net.Listener
+	quit        chan struct{}
 }
 
 func NewTCPProxy(extPort, intPort int) *TCPProxy {
 	return &TCPProxy{
-		ExtPort: extPort,
-		IntPort: intPort,
-		quit:    make(chan struct{}),
+		ExtPort:     extPort,
+		IntPort:     intPort,
+		PairTimeout: defaultPairTimeout,
+		quit:        make(chan struct{}),
 	}
 }
 
@@ -54,6 +60,11 @@ func (p *TCPProxy) acceptLoop(handler Handler) {
 	go accept(p.ext, extChan, "external")
 	go accept(p.intl, intChan, "internal")
 
+	pairTimeout := p.PairTimeout
+	if pairTimeout <= 0 {
+		pairTimeout = defaultPairTimeout
+	}
+
 	for {
 		select {
 		case <-p.quit:
@@ -66,7 +77,7 @@ func (p *TCPProxy) acceptLoop(handler Handler) {
 				select {
 				case intConn := <-intChan:
 					handler(extConn, intConn)
-				case <-time.After(10 * time.Second):
+				case <-time.After(pairTimeout):
 					log.Printf("[tcp] timeout waiting for internalConn for ext:%s", extConn.RemoteAddr())
 					extConn.Close()
 				}
@@ -6,15 +6,27 @@ import (
 	"net"
 	"sync/atomic"
 	"time"
+
+	"srv/internal/config"
 )
 
 var (
 	externalPort = 8080
 	internalPort = 9000
+	pairTimeout  = 10 * time.Second // external connections wait this long for an internal one, PAIR_TIMEOUT
+	readTimeout  = 15 * time.Second // a pipe gives up after this long without data, PIPE_READ_TIMEOUT
 	connID       int32
 )
 
 func main() {
+	cfg := config.Load()
+	if cfg.PairTimeout > 0 {
+		pairTimeout = cfg.PairTimeout
+	}
+	if cfg.PipeReadTimeout > 0 {
+		readTimeout = cfg.PipeReadTimeout
+	}
+
 	extListener, err := net.Listen("tcp", fmt.Sprintf(":%d", externalPort))
 	if err != nil {
 		log.Fatalf("failed to listen on external port: %v", err)
@@ -51,7 +63,7 @@ func main() {
 
 				go proxyPipe(extConn, intConn, tag+" ext→int")
 				proxyPipe(intConn, extConn, tag+" int→ext")
-			case <-time.After(10 * time.Second):
+			case <-time.After(pairTimeout):
 				log.Printf("timeout waiting for internal connection for %s", extConn.RemoteAddr())
 			}
 		}(extConn)
@@ -73,7 +85,7 @@ func acceptConnections(listener net.Listener, ch chan net.Conn, label string) {
 func proxyPipe(src, dst net.Conn, tag string) {
 	buf := make([]byte, 4096)
 	for {
-		_ = src.SetReadDeadline(time.Now().Add(15 * time.Second))
+		_ = src.SetReadDeadline(time.Now().Add(readTimeout))
 		n, err := src.Read(buf)
 		if err != nil {
 			log.Printf("%s read error: %v", tag, err)